@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/atlomak/norbot/internal/ui"
+)
+
+// config holds the settings read from the config file, which flags given on
+// the command line override.
+type config struct {
+	// Theme names the theme to use, a built-in one or one of Themes.
+	Theme string `json:"theme"`
+	// Themes are user-defined themes by name.
+	Themes map[string]ui.Theme `json:"themes"`
+	ASCII  bool                `json:"ascii"`
+	// Keys binds keys to bindings by name, instead of the default ones.
+	Keys map[string][]string `json:"keys"`
+}
+
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "norbot", "config.json"), nil
+}
+
+// loadConfig reads the config file at name. A missing file is an empty
+// config if optional, the default one needing not exist.
+func loadConfig(name string, optional bool) (config, error) {
+	var c config
+	data, err := os.ReadFile(name)
+	if optional && errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("%s: %w", name, err)
+	}
+	return c, nil
+}
+
+// theme looks up a theme by name, user-defined ones first, the default one
+// if name is empty.
+func (c config) theme(name string) (ui.Theme, error) {
+	if name == "" {
+		name = c.Theme
+	}
+	if name == "" {
+		name = ui.DefaultTheme
+	}
+	if t, ok := c.Themes[name]; ok {
+		return t, nil
+	}
+	if t, ok := ui.Themes[name]; ok {
+		return t, nil
+	}
+
+	var names []string
+	for n := range ui.Themes {
+		names = append(names, n)
+	}
+	for n := range c.Themes {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	return ui.Theme{}, fmt.Errorf("unknown theme %q, expected one of: %s", name, strings.Join(slices.Compact(names), ", "))
+}
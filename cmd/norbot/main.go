@@ -2,11 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/atlomak/norbot/internal/fsutils"
 	"github.com/atlomak/norbot/internal/llm"
 	"github.com/atlomak/norbot/internal/ui"
 	tea "github.com/charmbracelet/bubbletea"
@@ -15,6 +21,156 @@ import (
 )
 
 func main() {
+	conflicts := flag.String("conflict", "suffix", "how to resolve destination collisions: suffix, timestamp, skip or merge")
+	followSymlinks := flag.Bool("follow-symlinks", false, "descend into symlinked directories")
+	undo := flag.String("undo", "", "revert the changes recorded in a journal file")
+	output := flag.String("o", "", "where to write a reorganized archive (default: next to it)")
+	noGit := flag.Bool("no-git", false, "rename files in a git repository without staging the renames")
+	allowDirty := flag.Bool("allow-dirty", false, "move files with uncommitted changes or ignored by git")
+	gitCommit := flag.Bool("git-commit", false, "commit the staged renames when done")
+	updateLinks := flag.Bool("update-links", false, "rewrite relative links in Markdown, HTML and config files broken by the moves")
+	candidates := flag.Int("candidates", 1, "how many alternative plans to ask for")
+	themeName := flag.String("theme", "", "color theme: dark, light, high-contrast or one defined in the config file")
+	ascii := flag.Bool("ascii", false, "draw icons and trees with ASCII characters only")
+	configFile := flag.String("config", "", "config file to read (default: norbot/config.json in the user config directory)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [directory | archive | sftp://user@host/path | s3://bucket/prefix]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *undo != "" {
+		if err := undoJournal(*undo); err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	strategy, err := ui.ParseConflictStrategy(*conflicts)
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+	if *candidates < 1 {
+		fmt.Println("fatal: -candidates must be at least 1")
+		os.Exit(1)
+	}
+
+	// Only a config file asked for with -config has to exist.
+	defaultConfig := *configFile == ""
+	if defaultConfig {
+		if *configFile, err = configPath(); err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(1)
+		}
+	}
+	cfg, err := loadConfig(*configFile, defaultConfig)
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+	theme, err := cfg.theme(*themeName)
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+	keys, err := ui.ParseKeyMap(cfg.Keys)
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+	// See https://no-color.org, any value turns colors off.
+	noColor := os.Getenv("NO_COLOR") != ""
+	asciiOnly := *ascii || cfg.ASCII
+
+	target := "."
+	if flag.NArg() > 0 {
+		target = flag.Arg(0)
+	}
+	if fsutils.IsArchive(target) {
+		archive, err := fsutils.ReadArchive(target)
+		if err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(1)
+		}
+		reportDir, err := reportDir()
+		if err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(1)
+		}
+		run(archive, ui.Options{
+			Conflicts:   strategy,
+			UpdateLinks: *updateLinks,
+			ReportDir:   reportDir,
+			Theme:       theme,
+			NoColor:     noColor,
+			ASCII:       asciiOnly,
+			Keys:        &keys,
+		}, *candidates)
+
+		// The archive itself is left alone, so there is nothing to journal.
+		if archive.Changed() {
+			out := *output
+			if out == "" {
+				out = fsutils.ArchiveOutput(target)
+			}
+			if err := fsutils.WriteArchive(archive, out); err != nil {
+				fmt.Println("fatal:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Norbot packed the reorganized archive into %s\n", out)
+		}
+		return
+	}
+
+	fsys, closer, err := fsutils.Open(target)
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+	defer closer.Close()
+
+	var repo *fsutils.GitFS
+	if dir, ok := fsutils.LocalDir(target); ok && !*noGit {
+		repo, err = fsutils.NewGitFS(dir, *allowDirty)
+		if err == nil {
+			fsys = repo
+		} else if !errors.Is(err, fsutils.ErrNotGitRepo) {
+			fmt.Println("fatal:", err)
+			os.Exit(1)
+		}
+	}
+
+	journalDir, err := journalDir()
+	if err != nil {
+		fmt.Println("fatal:", err)
+		os.Exit(1)
+	}
+	journal := fsutils.NewJournal(journalDir, journalTarget(target))
+	defer journal.Close()
+
+	run(fsutils.WithJournal(fsys, journal), ui.Options{
+		Conflicts:      strategy,
+		FollowSymlinks: *followSymlinks,
+		UpdateLinks:    *updateLinks,
+		Journal:        journal.Path(),
+		Theme:          theme,
+		NoColor:        noColor,
+		ASCII:          asciiOnly,
+		Keys:           &keys,
+	}, *candidates)
+
+	if repo != nil && *gitCommit && len(repo.Moves()) > 0 {
+		if err := repo.Commit(); err != nil {
+			fmt.Println("fatal:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Norbot committed %d renames\n", len(repo.Moves()))
+	}
+}
+
+func run(fsys fsutils.FS, options ui.Options, candidates int) {
 	ctx := context.Background()
 	client, err := genai.NewClient(ctx, option.WithAPIKey(os.Getenv("GEMINI_API_KEY")))
 	if err != nil {
@@ -23,7 +179,10 @@ func main() {
 	defer client.Close()
 
 	llm := llm.InitGeminiModel(client, ctx)
+	llm.SetCandidates(candidates)
 
+	// The log is kept to show along with errors, and written out to debug.
+	options.Log = &ui.LogBuffer{}
 	if len(os.Getenv("DEBUG")) > 0 {
 		f, err := tea.LogToFile("debug.log", "debug")
 		if err != nil {
@@ -31,13 +190,73 @@ func main() {
 			os.Exit(1)
 		}
 		defer f.Close()
+		log.SetOutput(io.MultiWriter(f, options.Log))
 	} else {
-		log.SetOutput(io.Discard)
+		log.SetOutput(options.Log)
 	}
 
-	p := tea.NewProgram(ui.InitModel(llm))
+	p := tea.NewProgram(ui.InitModel(llm, fsys, options))
 	if _, err := p.Run(); err != nil {
 		fmt.Printf("Geez, there's been an error: %v", err)
 		os.Exit(1)
 	}
 }
+
+func journalDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "norbot", "journal"), nil
+}
+
+// reportDir is where reports of changes without a journal are exported.
+func reportDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "norbot", "reports"), nil
+}
+
+// journalTarget returns target in a form that can be opened again from any
+// working directory, without a password.
+func journalTarget(target string) string {
+	if !strings.Contains(target, "://") {
+		if abs, err := filepath.Abs(target); err == nil {
+			return abs
+		}
+		return target
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.User == nil {
+		return target
+	}
+	u.User = url.User(u.User.Username())
+	return u.String()
+}
+
+func undoJournal(name string) error {
+	target, entries, err := fsutils.ReadJournal(name)
+	if err != nil {
+		return err
+	}
+	fsys, closer, err := fsutils.Open(target)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	// Whatever state the files are in now, they were put there by Norbot.
+	if dir, ok := fsutils.LocalDir(target); ok {
+		if repo, err := fsutils.NewGitFS(dir, true); err == nil {
+			fsys = repo
+		}
+	}
+
+	if err := fsutils.Undo(fsys, entries); err != nil {
+		return err
+	}
+	fmt.Printf("Norbot put back %d changes in %s\n", len(entries), target)
+	return nil
+}
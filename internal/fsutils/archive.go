@@ -0,0 +1,279 @@
+package fsutils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+type archiveFormat int
+
+const (
+	notArchive archiveFormat = iota
+	zipArchive
+	tarArchive
+	tarGzArchive
+)
+
+func formatOf(name string) archiveFormat {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return zipArchive
+	case strings.HasSuffix(name, ".tar"):
+		return tarArchive
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return tarGzArchive
+	}
+	return notArchive
+}
+
+// IsArchive reports whether name is a zip, tar or tar.gz file Norbot can
+// open as a directory tree.
+func IsArchive(name string) bool {
+	if formatOf(name) == notArchive {
+		return false
+	}
+	info, err := os.Stat(name)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// ArchiveOutput returns the name of the restructured copy of an archive,
+// next to it and in the same format.
+func ArchiveOutput(name string) string {
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			return name[:len(name)-len(ext)] + ".reorganized" + name[len(name)-len(ext):]
+		}
+	}
+	return name + ".reorganized"
+}
+
+// ReadArchive loads a zip, tar or tar.gz archive into memory. Only files and
+// directories are kept, links and other special entries are dropped.
+func ReadArchive(name string) (*MemFS, error) {
+	fsys := NewMemFS()
+	var err error
+	switch formatOf(name) {
+	case zipArchive:
+		err = readZip(fsys, name)
+	case tarArchive, tarGzArchive:
+		err = readTar(fsys, name)
+	default:
+		err = fmt.Errorf("unsupported archive: %s", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fsys, nil
+}
+
+// archiveName turns an entry name into a path inside the MemFS, refusing
+// entries that would end up outside of it.
+func archiveName(name string) (string, error) {
+	clean := path.Clean(strings.TrimPrefix(strings.ReplaceAll(name, `\`, "/"), "./"))
+	if !fs.ValidPath(clean) || clean == "." {
+		return "", fmt.Errorf("invalid archive entry: %s", name)
+	}
+	return clean, nil
+}
+
+func readZip(fsys *MemFS, name string) error {
+	r, err := zip.OpenReader(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		p, err := archiveName(f.Name)
+		if err != nil {
+			return err
+		}
+		info := f.FileInfo()
+		if info.IsDir() {
+			fsys.add(p, info.Mode(), info.ModTime(), nil)
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", f.Name, err)
+		}
+		fsys.add(p, info.Mode(), info.ModTime(), data)
+	}
+	return nil
+}
+
+func readTar(fsys *MemFS, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if formatOf(name) == tarGzArchive {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p, err := archiveName(hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			fsys.add(p, fs.ModeDir|fs.FileMode(hdr.Mode).Perm(), hdr.ModTime, nil)
+		case tar.TypeReg:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", hdr.Name, err)
+			}
+			fsys.add(p, fs.FileMode(hdr.Mode).Perm(), hdr.ModTime, data)
+		}
+	}
+}
+
+// WriteArchive writes the whole tree of fsys into a new archive name, in the
+// format its extension asks for. An existing file is never replaced.
+func WriteArchive(fsys FS, name string) (err error) {
+	format := formatOf(name)
+	if format == notArchive {
+		return fmt.Errorf("unsupported archive: %s", name)
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(name)
+		}
+	}()
+
+	if format == zipArchive {
+		return writeZip(fsys, f)
+	}
+
+	var w io.Writer = f
+	if format == tarGzArchive {
+		gz := gzip.NewWriter(f)
+		defer func() {
+			if cerr := gz.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		w = gz
+	}
+	return writeTar(fsys, w)
+}
+
+func writeZip(fsys FS, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = p
+		if d.IsDir() {
+			hdr.Name += "/"
+			_, err = zw.CreateHeader(hdr)
+			return err
+		}
+
+		hdr.Method = zip.Deflate
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		return copyFile(fsys, p, fw)
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeTar(fsys FS, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = p
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		return copyFile(fsys, p, tw)
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func copyFile(fsys FS, name string, w io.Writer) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,194 @@
+package fsutils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var archiveModTime = time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC)
+
+func writeTestZip(t *testing.T, name string, entries ...string) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for _, entry := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: entry, Modified: archiveModTime, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(entry))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestTarGz writes a gzipped tar the way tar tools do, with an entry
+// for every directory before its contents.
+func writeTestTarGz(t *testing.T, name string, entries ...string) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	dirs := make(map[string]bool)
+	for _, entry := range entries {
+		for dir := path.Dir(entry); dir != "." && !dirs[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+			if err := tw.WriteHeader(&tar.Header{Name: dir + "/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: archiveModTime}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: entry, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(entry)), ModTime: archiveModTime}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(entry))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	tests := []struct {
+		source, ext string
+	}{
+		{"bundle.zip", ".zip"},
+		{"bundle.zip", ".tar"},
+		{"bundle.zip", ".tar.gz"},
+		{"bundle.tar.gz", ".zip"},
+		{"bundle.tar.gz", ".tar.gz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source+" to "+tt.ext, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, tt.source)
+			write := writeTestZip
+			if strings.HasSuffix(tt.source, ".tar.gz") {
+				write = writeTestTarGz
+			}
+			write(t, src,
+				"bundle/README.md",
+				"bundle/Final Report.pdf",
+				"bundle/img/logo.png",
+			)
+
+			fsys, err := ReadArchive(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fsys.Changed() {
+				t.Fatal("expected a freshly read archive to be unchanged")
+			}
+
+			if err := CreateDir(fsys, "bundle/docs/"); err != nil {
+				t.Fatal(err)
+			}
+			if err := MoveFile(fsys, "bundle/Final Report.pdf", "bundle/docs/final_report.pdf"); err != nil {
+				t.Fatal(err)
+			}
+			if !fsys.Changed() {
+				t.Fatal("expected archive to be changed")
+			}
+
+			out := filepath.Join(dir, "out"+tt.ext)
+			if err := WriteArchive(fsys, out); err != nil {
+				t.Fatal(err)
+			}
+			if err := WriteArchive(fsys, out); err == nil {
+				t.Fatal("expected existing output not to be replaced")
+			}
+
+			written, err := ReadArchive(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files, err := ReadDir(written, ".", -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectedOutput := `bundle/
+bundle/README.md
+bundle/docs/
+bundle/docs/final_report.pdf
+bundle/img/
+bundle/img/logo.png
+`
+			if output := files.String(); output != expectedOutput {
+				t.Fatalf("\nexpected:\n%s\ngot:\n%s\n", expectedOutput, output)
+			}
+
+			b, err := fs.ReadFile(written, "bundle/docs/final_report.pdf")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "bundle/Final Report.pdf" {
+				t.Fatalf("unexpected content: %s", b)
+			}
+			info, err := written.Stat("bundle/README.md")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.ModTime().Equal(archiveModTime) {
+				t.Fatalf("expected: %v got: %v", archiveModTime, info.ModTime())
+			}
+		})
+	}
+}
+
+func TestReadArchiveRejectsEscapingEntries(t *testing.T) {
+	dir := t.TempDir()
+
+	zipName := filepath.Join(dir, "evil.zip")
+	writeTestZip(t, zipName, "../evil.txt")
+	if _, err := ReadArchive(zipName); err == nil {
+		t.Fatal("expected zip entry outside of the archive to be rejected")
+	}
+
+	tarName := filepath.Join(dir, "evil.tar")
+	f, err := os.Create(tarName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	tw.WriteHeader(&tar.Header{Name: "/etc/evil", Typeflag: tar.TypeReg, Mode: 0644})
+	tw.Close()
+	f.Close()
+	if _, err := ReadArchive(tarName); err == nil {
+		t.Fatal("expected absolute tar entry to be rejected")
+	}
+}
+
+func TestArchiveOutput(t *testing.T) {
+	tests := map[string]string{
+		"bundle.zip":   "bundle.reorganized.zip",
+		"dir/a.tar.gz": "dir/a.reorganized.tar.gz",
+		"a.TGZ":        "a.reorganized.TGZ",
+		"backup.tar":   "backup.reorganized.tar",
+	}
+	for in, expected := range tests {
+		if got := ArchiveOutput(in); got != expected {
+			t.Errorf("ArchiveOutput(%s) = %s, want %s", in, got, expected)
+		}
+	}
+}
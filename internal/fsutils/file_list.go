@@ -1,110 +1,146 @@
 package fsutils
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
-	"os"
+	"strings"
 )
 
+var ErrSymlinkLoop = errors.New("symlink loop")
+
 type DirMsg struct {
 	Files []Node
 	Err   error
 }
 
+// NodeKind tells what kind of filesystem object a Node is.
+type NodeKind int
+
+const (
+	FileNode NodeKind = iota
+	DirNode
+	SymlinkNode
+	// SpecialNode covers sockets, named pipes and devices.
+	SpecialNode
+)
+
 type Node struct {
-	Info     fs.FileInfo
+	Info fs.FileInfo
+	Kind NodeKind
+	// Err is set when the node is a directory that could not be read.
+	Err      error
 	Children []Node
 }
 
+// Movable reports whether Norbot may move the node. Special files are
+// bound to their location by whatever created them.
+func (n Node) Movable() bool {
+	return n.Kind != SpecialNode
+}
+
 type FileList []Node
 
-func ReadDir(root string, depth int) (FileList, error) {
-	entries, err := os.ReadDir(root)
-	if err != nil {
-		return nil, err
-	}
+type ScanError struct {
+	Path string
+	Err  error
+}
+
+func (e ScanError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+func ReadDir(fsys FS, root string, depth int) (FileList, error) {
+	return Scan(fsys, root, ScanOptions{Depth: depth})
+}
+
+// Walk calls fn for every node in the list, depth first, with the node path
+// relative to the scanned root. Directories are suffixed with "/", the same
+// way String prints them.
+func (l FileList) Walk(fn func(name string, n Node)) {
+	walk("", l, fn)
+}
 
-	var files []Node
-	for _, entry := range entries {
-		info, err := entry.Info()
-		if err != nil {
-			continue
+func walk(root string, files []Node, fn func(name string, n Node)) {
+	for _, f := range files {
+		relPath := f.Info.Name()
+		if root != "" {
+			relPath = root + "/" + f.Info.Name()
+		}
+
+		fn(displayName(relPath, f), f)
+
+		if f.Children != nil {
+			walk(relPath, f.Children, fn)
 		}
+	}
+}
 
-		var node Node
-		if depth != 0 && info.IsDir() {
-			children, err := ReadDir(fmt.Sprintf("%s/%s", root, info.Name()), depth-1)
-			if err != nil {
-				return nil, err
-			}
-			node = Node{
-				Info:     info,
-				Children: children,
-			}
-		} else {
-			node = Node{
-				Info:     info,
-				Children: nil,
-			}
+// Errors returns the paths that could not be read during the scan.
+func (l FileList) Errors() []ScanError {
+	var errs []ScanError
+	l.Walk(func(name string, n Node) {
+		if n.Err != nil {
+			errs = append(errs, ScanError{Path: name, Err: n.Err})
 		}
-		files = append(files, node)
+	})
+	return errs
+}
+
+func displayName(relPath string, n Node) string {
+	if n.Info.IsDir() || n.Children != nil {
+		return relPath + "/"
 	}
-	return files, err
+	return relPath
 }
 
 func (l FileList) String() string {
-	return listFiles("", l)
+	var b strings.Builder
+	listFiles(&b, "", l)
+	return b.String()
 }
 
 func (l FileList) Details() string {
-	return listFilesDetails("", l)
+	var b strings.Builder
+	listFilesDetails(&b, "", l)
+	return b.String()
 }
 
-func listFiles(root string, files []Node) string {
-	s := ""
+func listFiles(b *strings.Builder, root string, files []Node) {
 	for _, f := range files {
 		relPath := f.Info.Name()
 		if root != "" {
-			relPath = fmt.Sprintf("%s/%s", root, f.Info.Name())
+			relPath = root + "/" + f.Info.Name()
 		}
 
-		name := relPath
-		if f.Info.IsDir() {
-			name += "/"
-		}
-
-		s += fmt.Sprintf("%s\n", name)
+		b.WriteString(displayName(relPath, f))
+		b.WriteByte('\n')
 
 		if f.Children != nil {
-			s += listFiles(relPath, f.Children)
+			listFiles(b, relPath, f.Children)
 		}
 	}
-	return s
 }
 
-func listFilesDetails(root string, files []Node) string {
+func listFilesDetails(b *strings.Builder, root string, files []Node) {
 	timeFormat := "Jan _2  2006"
-	s := ""
 	for _, f := range files {
 		relPath := f.Info.Name()
 		if root != "" {
-			relPath = fmt.Sprintf("%s/%s", root, f.Info.Name())
+			relPath = root + "/" + f.Info.Name()
 		}
 
-		name := relPath
-		if f.Info.IsDir() {
-			name += "/"
+		// Special files stay where they are, no need to ask about them.
+		if f.Movable() {
+			fmt.Fprintf(b, "%8d %s %s\n",
+				f.Info.Size(),
+				f.Info.ModTime().Format(timeFormat),
+				displayName(relPath, f),
+			)
 		}
 
-		s += fmt.Sprintf("%8d %s %s\n",
-			f.Info.Size(),
-			f.Info.ModTime().Format(timeFormat),
-			name,
-		)
-
 		if f.Children != nil {
-			s += listFilesDetails(relPath, f.Children)
+			listFilesDetails(b, relPath, f.Children)
 		}
 	}
-	return s
 }
@@ -1,15 +1,24 @@
 package fsutils
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
+// testFS holds the same tree for every test, the sample one.
+func testFS(t *testing.T) *MemFS {
+	t.Helper()
+	return NewSampleFS()
+}
+
 func TestReadDir(t *testing.T) {
 
 	depth := 1
-	root := "../test_dir"
+	root := "."
 
-	files, err := ReadDir(root, depth)
+	files, err := ReadDir(testFS(t), root, depth)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -31,9 +40,9 @@ func TestReadDir(t *testing.T) {
 func TestListFiles(t *testing.T) {
 
 	depth := 1
-	root := "../test_dir"
+	root := "."
 
-	files, err := ReadDir(root, depth)
+	files, err := ReadDir(testFS(t), root, depth)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -59,9 +68,9 @@ test_file_3.txt
 func TestListFilesDetails(t *testing.T) {
 
 	depth := 1
-	root := "../test_dir"
+	root := "."
 
-	files, err := ReadDir(root, depth)
+	files, err := ReadDir(testFS(t), root, depth)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -71,3 +80,62 @@ func TestListFilesDetails(t *testing.T) {
 	t.Logf("\n%s", output)
 
 }
+
+func TestScanFollowSymlinks(t *testing.T) {
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, "dir"), 0755)
+	os.WriteFile(filepath.Join(root, "dir/file.txt"), nil, 0644)
+	os.Symlink("../dir", filepath.Join(root, "dir/loop"))
+	os.Symlink("dir", filepath.Join(root, "link"))
+
+	files, err := Scan(DirFS(root), ".", ScanOptions{Depth: -1, FollowSymlinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := files.String()
+	expectedOutput :=
+		`dir/
+dir/file.txt
+dir/loop
+link/
+link/file.txt
+link/loop
+`
+	if output != expectedOutput {
+		t.Fatalf("\nexpected:\n%s\ngot:\n%s\n", expectedOutput, output)
+	}
+
+	errs := files.Errors()
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 loops, got: %v", errs)
+	}
+	for _, e := range errs {
+		if !errors.Is(e.Err, ErrSymlinkLoop) {
+			t.Fatalf("expected: %v got: %v", ErrSymlinkLoop, e)
+		}
+	}
+}
+
+func TestScanUnreadableDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, "locked"), 0755)
+	os.WriteFile(filepath.Join(root, "file.txt"), nil, 0644)
+	os.Chmod(filepath.Join(root, "locked"), 0)
+	t.Cleanup(func() { os.Chmod(filepath.Join(root, "locked"), 0755) })
+
+	files, err := ReadDir(DirFS(root), ".", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected: 2 got: %d", len(files))
+	}
+	errs := files.Errors()
+	if len(errs) != 1 || errs[0].Path != "locked/" {
+		t.Fatalf("expected error for locked/, got: %v", errs)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build unix
+
+package fsutils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestScanNodeKinds(t *testing.T) {
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, "dir"), 0755)
+	os.WriteFile(filepath.Join(root, "dir/file.txt"), nil, 0644)
+	os.Symlink("dir", filepath.Join(root, "link"))
+	if err := syscall.Mkfifo(filepath.Join(root, "fifo"), 0644); err != nil {
+		t.Skip("mkfifo not supported:", err)
+	}
+
+	files, err := ReadDir(DirFS(root), ".", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]NodeKind{
+		"dir/":         DirNode,
+		"dir/file.txt": FileNode,
+		"fifo":         SpecialNode,
+		"link":         SymlinkNode,
+	}
+	got := make(map[string]NodeKind)
+	files.Walk(func(name string, n Node) {
+		got[name] = n.Kind
+	})
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected: %v got: %v", expected, got)
+	}
+
+	if details := files.Details(); strings.Contains(details, "fifo") {
+		t.Fatalf("special file listed in details:\n%s", details)
+	}
+}
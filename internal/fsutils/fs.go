@@ -0,0 +1,76 @@
+package fsutils
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FS is a writable filesystem Norbot scans and reorganizes. Like io/fs,
+// names are slash separated paths relative to the root of the filesystem,
+// with "." naming the root itself.
+type FS interface {
+	fs.FS
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Stat(name string) (fs.FileInfo, error)
+	// Lstat is Stat without following a symlink at name.
+	Lstat(name string) (fs.FileInfo, error)
+	// Rename moves oldpath to newpath. It never replaces an existing
+	// newpath, failing with an error matching fs.ErrExist instead.
+	Rename(oldpath, newpath string) error
+	MkdirAll(name string, perm fs.FileMode) error
+	// WriteFile replaces the contents of name, creating it with perm if it
+	// does not exist.
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	// Remove removes a file or an empty directory.
+	Remove(name string) error
+	// SameFile reports whether both infos, returned by this filesystem,
+	// describe the same file.
+	SameFile(fi1, fi2 fs.FileInfo) bool
+}
+
+type osFS struct {
+	root string
+	fs.FS
+}
+
+// DirFS returns the directory tree rooted at dir on the local disk.
+func DirFS(dir string) FS {
+	return osFS{root: dir, FS: os.DirFS(dir)}
+}
+
+func (f osFS) path(name string) string {
+	return filepath.Join(f.root, filepath.FromSlash(name))
+}
+
+func (f osFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(f.path(name))
+}
+
+func (f osFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(f.path(name))
+}
+
+func (f osFS) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(f.path(name))
+}
+
+func (f osFS) Rename(oldpath, newpath string) error {
+	return renameNoReplace(f.path(oldpath), f.path(newpath))
+}
+
+func (f osFS) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(f.path(name), perm)
+}
+
+func (f osFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(f.path(name), data, perm)
+}
+
+func (f osFS) Remove(name string) error {
+	return os.Remove(f.path(name))
+}
+
+func (f osFS) SameFile(fi1, fi2 fs.FileInfo) bool {
+	return os.SameFile(fi1, fi2)
+}
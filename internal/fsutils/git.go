@@ -0,0 +1,236 @@
+package fsutils
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrNotGitRepo = errors.New("not inside a git working tree")
+	ErrGitDirty   = errors.New("file has uncommitted changes or is ignored by git")
+)
+
+// GitMove is a rename staged in the index by GitFS.
+type GitMove struct {
+	From, To string
+}
+
+// GitFS is a directory inside a git working tree. Tracked files are moved
+// with git mv, so the renames are staged and history follows them, while
+// untracked files are renamed as usual.
+type GitFS struct {
+	FS
+	dir        string
+	prefix     string
+	allowDirty bool
+	// staged is set when the index already had changes before Norbot
+	// touched it; committing would sweep them into the reorganization.
+	staged bool
+	moves  []GitMove
+	edited []string
+}
+
+// NewGitFS returns the directory tree rooted at dir, which has to be inside
+// a git working tree. Unless allowDirty is set, moving files with
+// uncommitted changes, or ones ignored by git, fails with ErrGitDirty.
+func NewGitFS(dir string, allowDirty bool) (*GitFS, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	g := &GitFS{FS: DirFS(abs), dir: abs, allowDirty: allowDirty}
+
+	out, err := g.git("rev-parse", "--is-inside-work-tree", "--show-prefix")
+	lines := strings.Split(string(out), "\n")
+	if err != nil || lines[0] != "true" {
+		return nil, fmt.Errorf("%w: %s", ErrNotGitRepo, dir)
+	}
+	// Status reports paths from the top of the working tree.
+	g.prefix = lines[1]
+	if _, err := g.git("diff", "--cached", "--quiet"); err != nil {
+		g.staged = true
+	}
+	return g, nil
+}
+
+func (g *GitFS) command(args ...string) *exec.Cmd {
+	cmd := exec.Command("git", append([]string{"-C", g.dir}, args...)...)
+	// Names are file names, never glob patterns.
+	cmd.Env = append(os.Environ(), "GIT_LITERAL_PATHSPECS=1")
+	return cmd
+}
+
+func (g *GitFS) git(args ...string) ([]byte, error) {
+	return gitOutput(g.command(args...))
+}
+
+func gitOutput(cmd *exec.Cmd) ([]byte, error) {
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return out, fmt.Errorf("%s %s: %s", cmd.Args[0], cmd.Args[3], strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return out, err
+}
+
+// ReadDir hides the repository itself, it is not for reorganizing.
+func (g *GitFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := g.FS.ReadDir(name)
+	return slices.DeleteFunc(entries, func(e fs.DirEntry) bool {
+		return e.Name() == ".git"
+	}), err
+}
+
+func (g *GitFS) Rename(oldpath, newpath string) error {
+	// git mv moves into an existing directory instead of failing.
+	if _, err := g.FS.Lstat(newpath); err == nil {
+		return &fs.PathError{Op: "rename", Path: newpath, Err: fs.ErrExist}
+	}
+
+	if !g.allowDirty {
+		if err := g.dirty(oldpath); err != nil {
+			return err
+		}
+	}
+
+	tracked, err := g.tracked(oldpath)
+	if err != nil {
+		return err
+	}
+	if !tracked {
+		return g.FS.Rename(oldpath, newpath)
+	}
+
+	if _, err := g.git("mv", "--", oldpath, newpath); err != nil {
+		return err
+	}
+	g.record(oldpath, newpath)
+	return nil
+}
+
+// WriteFile stages the new contents of tracked files that had no other
+// changes, so that they are committed along with the renames.
+func (g *GitFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	tracked, err := g.tracked(name)
+	if err != nil {
+		return err
+	}
+	stage := tracked && g.dirty(name) == nil
+
+	if err := g.FS.WriteFile(name, data, perm); err != nil {
+		return err
+	}
+	if !stage {
+		return nil
+	}
+	if _, err := g.git("add", "--", name); err != nil {
+		return err
+	}
+	g.edited = append(g.edited, name)
+	return nil
+}
+
+func (g *GitFS) tracked(name string) (bool, error) {
+	out, err := g.git("ls-files", "-z", "--", name)
+	return len(out) > 0, err
+}
+
+// dirty fails when name, or anything below it, is ignored or differs from
+// HEAD other than by renames made here.
+func (g *GitFS) dirty(name string) error {
+	out, err := g.git("status", "--porcelain=v1", "-z", "--ignored=matching", "--untracked-files=all", "--", name)
+	if err != nil {
+		return err
+	}
+
+	records := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	for i := 0; i < len(records); i++ {
+		record := records[i]
+		if len(record) < 4 {
+			continue
+		}
+		x, y, file := record[0], record[1], strings.TrimPrefix(record[3:], g.prefix)
+		if x == 'R' || x == 'C' {
+			// The source of a rename or copy follows as its own record.
+			i++
+		}
+
+		switch {
+		case x == '?' && y == '?':
+			// Untracked files are not lost when moved.
+		case x == '!' && y == '!':
+			return fmt.Errorf("%w: %s", ErrGitDirty, file)
+		case (x == 'R' || x == 'A') && y == ' ' && g.moved(file):
+			// Outside of the pathspec, a rename shows up as an addition.
+		default:
+			return fmt.Errorf("%w: %s", ErrGitDirty, file)
+		}
+	}
+	return nil
+}
+
+// moved reports whether name is, or is below, the destination of a move.
+func (g *GitFS) moved(name string) bool {
+	for _, m := range g.moves {
+		if name == m.To || strings.HasPrefix(name, m.To+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *GitFS) record(oldpath, newpath string) {
+	for i, m := range g.moves {
+		if m.To == oldpath {
+			// Moving through a temporary name is a single move.
+			g.moves[i].To = newpath
+			if m.From == newpath {
+				g.moves = append(g.moves[:i], g.moves[i+1:]...)
+			}
+			return
+		}
+	}
+	g.moves = append(g.moves, GitMove{From: oldpath, To: newpath})
+}
+
+// Moves returns the renames staged so far.
+func (g *GitFS) Moves() []GitMove {
+	return g.moves
+}
+
+// Commit commits the staged renames with a message listing them. It refuses
+// to when the index had other changes staged before.
+func (g *GitFS) Commit() error {
+	if len(g.moves) == 0 {
+		return nil
+	}
+	if g.staged {
+		return errors.New("the index had staged changes before reorganizing, commit the renames yourself")
+	}
+
+	cmd := g.command("commit", "--quiet", "--file=-")
+	cmd.Stdin = strings.NewReader(g.commitMessage())
+	_, err := gitOutput(cmd)
+	return err
+}
+
+func (g *GitFS) commitMessage() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Reorganize %s with Norbot\n\n", filepath.Base(g.dir))
+	for _, m := range g.moves {
+		fmt.Fprintf(&b, "%s -> %s\n", m.From, m.To)
+	}
+	if len(g.edited) > 0 {
+		b.WriteString("\nUpdated links in:\n")
+		for _, name := range g.edited {
+			fmt.Fprintf(&b, "%s\n", name)
+		}
+	}
+	return b.String()
+}
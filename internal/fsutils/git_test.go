@@ -0,0 +1,163 @@
+package fsutils
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func gitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_AUTHOR_NAME", "Norbot")
+	t.Setenv("GIT_AUTHOR_EMAIL", "norbot@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Norbot")
+	t.Setenv("GIT_COMMITTER_EMAIL", "norbot@example.com")
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"notes.txt":     "notes",
+		"report.pdf":    "report",
+		"Dir/a.txt":     "a",
+		".gitignore":    "*.log\n",
+		"debug.log":     "ignored",
+		"untracked.txt": "untracked",
+	}
+	for name, content := range files {
+		name = filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(name), 0755)
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runGit(t, dir, "init", "--quiet")
+	runGit(t, dir, "add", "notes.txt", "report.pdf", "Dir", ".gitignore")
+	runGit(t, dir, "commit", "--quiet", "-m", "initial")
+	return dir
+}
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+func TestGitFSStagesRenames(t *testing.T) {
+	dir := gitRepo(t)
+	fsys, err := NewGitFS(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ReadDir(fsys, ".", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(files.String(), ".git/") {
+		t.Fatalf("expected .git to be hidden:\n%s", files)
+	}
+
+	if err := CreateDir(fsys, "docs"); err != nil {
+		t.Fatal(err)
+	}
+	for _, move := range [][2]string{
+		{"report.pdf", "docs/report.pdf"},
+		{"Dir", "dir"},
+		{"untracked.txt", "docs/untracked.txt"},
+	} {
+		if err := MoveFile(fsys, move[0], move[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := fsys.WriteFile("notes.txt", []byte("see docs/report.pdf"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	status := runGit(t, dir, "status", "--porcelain")
+	for _, expected := range []string{"M  notes.txt", "R  report.pdf -> docs/report.pdf", "R  Dir/a.txt -> dir/a.txt", "?? docs/untracked.txt"} {
+		if !strings.Contains(status, expected) {
+			t.Errorf("expected %q in status:\n%s", expected, status)
+		}
+	}
+
+	if err := fsys.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	message := runGit(t, dir, "log", "-1", "--format=%B")
+	expectedMessage := "Reorganize " + filepath.Base(dir) + " with Norbot\n\nreport.pdf -> docs/report.pdf\nDir -> dir\n\nUpdated links in:\nnotes.txt\n"
+	if strings.TrimSpace(message) != strings.TrimSpace(expectedMessage) {
+		t.Fatalf("\nexpected:\n%s\ngot:\n%s\n", expectedMessage, message)
+	}
+	if status := runGit(t, dir, "status", "--porcelain"); status != "?? docs/untracked.txt\n" {
+		t.Fatalf("expected only the untracked file left, got:\n%s", status)
+	}
+}
+
+func TestGitFSRefusesDirtyFiles(t *testing.T) {
+	dir := gitRepo(t)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("edited"), 0644)
+
+	fsys, err := NewGitFS(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"notes.txt", "debug.log"} {
+		if err := MoveFile(fsys, name, "moved-"+name); !errors.Is(err, ErrGitDirty) {
+			t.Errorf("expected ErrGitDirty moving %s, got: %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s to stay in place: %v", name, err)
+		}
+	}
+
+	fsys, err = NewGitFS(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveFile(fsys, "notes.txt", "moved.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "moved.txt")); string(b) != "edited" {
+		t.Fatalf("expected changes to move along, got: %s", b)
+	}
+}
+
+func TestGitFSSubdirectory(t *testing.T) {
+	dir := gitRepo(t)
+	fsys, err := NewGitFS(filepath.Join(dir, "Dir"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveFile(fsys, "a.txt", "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveFile(fsys, "b.txt", "B.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if moves := fsys.Moves(); len(moves) != 1 || moves[0] != (GitMove{From: "a.txt", To: "B.txt"}) {
+		t.Fatalf("unexpected moves: %v", moves)
+	}
+	if status := runGit(t, dir, "status", "--porcelain", "--", "Dir"); status != "R  Dir/a.txt -> Dir/B.txt\n" {
+		t.Fatalf("unexpected status:\n%s", status)
+	}
+}
+
+func TestNewGitFSOutsideRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	t.Setenv("GIT_CEILING_DIRECTORIES", os.TempDir())
+	if _, err := NewGitFS(t.TempDir(), false); !errors.Is(err, ErrNotGitRepo) {
+		t.Fatalf("expected ErrNotGitRepo, got: %v", err)
+	}
+}
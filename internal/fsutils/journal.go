@@ -0,0 +1,232 @@
+package fsutils
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	JournalMkdir  = "mkdir"
+	JournalMove   = "move"
+	JournalEdit   = "edit"
+	JournalCreate = "create"
+)
+
+// JournalEntry is a single change applied to a filesystem. Path is the
+// created directory, the moved source or the written file, To the move
+// destination and Data the contents of an edited file before the edit.
+type JournalEntry struct {
+	Op   string    `json:"op"`
+	Path string    `json:"path"`
+	To   string    `json:"to,omitempty"`
+	Data []byte    `json:"data,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+type journalHeader struct {
+	Target string `json:"target"`
+}
+
+// Journal records changes to a file as they are applied, one JSON object per
+// line after a header naming the target, so that they can be undone later.
+// The file is only created once the first change is recorded.
+type Journal struct {
+	path   string
+	target string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewJournal returns a journal written to a new file in dir for changes to
+// target, a local directory or a remote URL.
+func NewJournal(dir, target string) *Journal {
+	name := time.Now().Format("20060102-150405.000000000") + ".jsonl"
+	return &Journal{path: filepath.Join(dir, name), target: target}
+}
+
+func (j *Journal) Path() string {
+	return j.path
+}
+
+func (j *Journal) Record(e JournalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		if err := os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+			return fmt.Errorf("failed to create journal: %w", err)
+		}
+		f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create journal: %w", err)
+		}
+		j.file = f
+		if err := j.write(journalHeader{Target: j.target}); err != nil {
+			return err
+		}
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	return j.write(e)
+}
+
+// write appends v and syncs, so the journal survives a crash right after
+// the change it describes.
+func (j *Journal) write(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return j.file.Sync()
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+	return j.file.Close()
+}
+
+// ReadJournal returns the target and the entries of a journal file.
+func ReadJournal(name string) (string, []JournalEntry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	// A decoder rather than a line scanner, as the old contents of an edited
+	// file make for lines of any length.
+	dec := json.NewDecoder(bufio.NewReader(f))
+	var header journalHeader
+	if err := dec.Decode(&header); err == io.EOF {
+		return "", nil, fmt.Errorf("empty journal: %s", name)
+	} else if err != nil {
+		return "", nil, fmt.Errorf("invalid journal header: %w", err)
+	}
+
+	var entries []JournalEntry
+	for {
+		var e JournalEntry
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return "", nil, fmt.Errorf("invalid journal entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return header.Target, entries, nil
+}
+
+// Undo reverts entries in reverse order. Moves are moved back, edited files
+// get their previous contents and created files and directories are removed,
+// directories only if they are empty again. It keeps going past failures
+// and returns all of them.
+func Undo(fsys FS, entries []JournalEntry) error {
+	var errs []error
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		switch e.Op {
+		case JournalMove:
+			if err := fsys.Rename(e.To, e.Path); err != nil {
+				errs = append(errs, fmt.Errorf("failed to move back %s: %w", e.To, err))
+			}
+		case JournalMkdir:
+			if err := fsys.Remove(e.Path); err != nil {
+				errs = append(errs, fmt.Errorf("failed to remove directory %s: %w", e.Path, err))
+			}
+		case JournalEdit:
+			if err := fsys.WriteFile(e.Path, e.Data, 0644); err != nil {
+				errs = append(errs, fmt.Errorf("failed to restore %s: %w", e.Path, err))
+			}
+		case JournalCreate:
+			if err := fsys.Remove(e.Path); err != nil {
+				errs = append(errs, fmt.Errorf("failed to remove %s: %w", e.Path, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ErrNotJournaled is returned for a change that was made on disk but could
+// not be recorded, so undoing will not revert it.
+var ErrNotJournaled = errors.New("change made but not journaled")
+
+type journaledFS struct {
+	FS
+	journal *Journal
+}
+
+// WithJournal returns fsys recording every rename, every written file and
+// every directory created by MkdirAll in j.
+func WithJournal(fsys FS, j *Journal) FS {
+	return journaledFS{FS: fsys, journal: j}
+}
+
+func (f journaledFS) Rename(oldpath, newpath string) error {
+	if err := f.FS.Rename(oldpath, newpath); err != nil {
+		return err
+	}
+	if err := f.journal.Record(JournalEntry{Op: JournalMove, Path: oldpath, To: newpath}); err != nil {
+		return fmt.Errorf("%w, moved %s to %s: %w", ErrNotJournaled, oldpath, newpath, err)
+	}
+	return nil
+}
+
+func (f journaledFS) MkdirAll(name string, perm fs.FileMode) error {
+	var missing []string
+	p := ""
+	for _, part := range strings.Split(path.Clean(name), "/") {
+		p = path.Join(p, part)
+		if _, err := f.FS.Stat(p); errors.Is(err, fs.ErrNotExist) {
+			missing = append(missing, p)
+		}
+	}
+
+	err := f.FS.MkdirAll(name, perm)
+	for _, dir := range missing {
+		if _, serr := f.FS.Stat(dir); serr != nil {
+			break
+		}
+		if rerr := f.journal.Record(JournalEntry{Op: JournalMkdir, Path: dir}); rerr != nil {
+			return fmt.Errorf("%w, created %s: %w", ErrNotJournaled, dir, rerr)
+		}
+	}
+	return err
+}
+
+// WriteFile records the previous contents before writing, restoring them is
+// harmless should the write fail.
+func (f journaledFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	e := JournalEntry{Op: JournalEdit, Path: name}
+	old, err := fs.ReadFile(f.FS, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		e.Op = JournalCreate
+	} else if err != nil {
+		return err
+	}
+	e.Data = old
+	if err := f.journal.Record(e); err != nil {
+		return err
+	}
+	return f.FS.WriteFile(name, data, perm)
+}
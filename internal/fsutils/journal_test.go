@@ -0,0 +1,135 @@
+package fsutils
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJournalUndo(t *testing.T) {
+	base := testFS(t)
+	before, err := ReadDir(base, ".", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journal := NewJournal(t.TempDir(), "mem://test")
+	fsys := WithJournal(base, journal)
+
+	if err := CreateDir(fsys, "Texts/Old/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveFile(fsys, "Dir/", "Texts/Old/Dir/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveFile(fsys, "test_file.txt", "Texts/test_file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	target, entries, err := ReadJournal(journal.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "mem://test" {
+		t.Fatalf("expected: mem://test got: %s", target)
+	}
+
+	var got []JournalEntry
+	for _, e := range entries {
+		got = append(got, JournalEntry{Op: e.Op, Path: e.Path, To: e.To})
+	}
+	expected := []JournalEntry{
+		{Op: JournalMkdir, Path: "Texts"},
+		{Op: JournalMkdir, Path: "Texts/Old"},
+		{Op: JournalMove, Path: "Dir", To: "Texts/Old/Dir"},
+		{Op: JournalMove, Path: "test_file.txt", To: "Texts/test_file.txt"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected: %v got: %v", expected, got)
+	}
+
+	if err := Undo(base, entries); err != nil {
+		t.Fatal(err)
+	}
+	after, err := ReadDir(base, ".", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.String() != before.String() {
+		t.Fatalf("\nexpected:\n%s\ngot:\n%s\n", before, after)
+	}
+}
+
+func TestJournalNotCreatedWithoutChanges(t *testing.T) {
+	dir := t.TempDir()
+	journal := NewJournal(dir, ".")
+	if err := journal.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*")); len(matches) != 0 {
+		t.Fatalf("expected no journal file, got: %v", matches)
+	}
+}
+
+func TestJournalUndoLargeEdit(t *testing.T) {
+	base := NewMemFS()
+	// Well past the 64KB a line scanner reads, once base64 encoded.
+	old := "[b](b.md)\n" + strings.Repeat("lorem ipsum\n", 10000)
+	base.WriteFile("a.md", []byte(old), 0644)
+	base.WriteFile("b.md", nil, 0644)
+
+	journal := NewJournal(t.TempDir(), "mem://test")
+	fsys := WithJournal(base, journal)
+	if err := CreateDir(fsys, "dir/"); err != nil {
+		t.Fatal(err)
+	}
+	moves := map[string]string{"b.md": "dir/b.md"}
+	if err := MoveFile(fsys, "b.md", "dir/b.md"); err != nil {
+		t.Fatal(err)
+	}
+	edits, err := FindLinkEdits(fsys, moves)
+	if err != nil || len(edits) != 1 {
+		t.Fatalf("expected one edit, got: %v %v", edits, err)
+	}
+	if err := ApplyLinkEdits(fsys, edits); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+
+	_, entries, err := ReadJournal(journal.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Undo(base, entries); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := fs.ReadFile(base, "a.md"); string(b) != old {
+		t.Fatalf("expected contents to be restored, got %d bytes", len(b))
+	}
+}
+
+func TestJournalFailureAfterMove(t *testing.T) {
+	base := NewMemFS()
+	base.WriteFile("a.txt", nil, 0644)
+	// The journal cannot be created under a file.
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fsys := WithJournal(base, NewJournal(filepath.Join(blocker, "journal"), "mem://test"))
+
+	err := MoveFile(fsys, "a.txt", "b.txt")
+	if !errors.Is(err, ErrNotJournaled) || strings.Contains(err.Error(), "failed to move") {
+		t.Fatalf("expected a journal error, got: %v", err)
+	}
+	if _, err := base.Stat("b.txt"); err != nil {
+		t.Fatalf("expected the file moved: %v", err)
+	}
+}
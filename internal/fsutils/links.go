@@ -0,0 +1,261 @@
+package fsutils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// maxLinkFileSize keeps huge logs and data dumps that happen to have a text
+// extension out of the link scan.
+const maxLinkFileSize = 1 << 20
+
+var (
+	markdownLink = regexp.MustCompile(`\]\(\s*<?([^()<>\s]+)>?(?:\s+"[^"]*")?\s*\)`)
+	markdownRef  = regexp.MustCompile(`(?m)^ {0,3}\[[^\]]+\]:\s*<?([^\s<>]+)>?`)
+	htmlLink     = regexp.MustCompile(`(?i)\b(?:href|src)\s*=\s*["']([^"']+)["']`)
+	quotedString = regexp.MustCompile(`["']([^"'\s]+)["']`)
+	yamlValue    = regexp.MustCompile(`(?m):[ \t]+([^\s"'#][^\s#]*)[ \t]*$`)
+)
+
+// linkPatterns lists, per file extension, the patterns whose first group is
+// a reference to another file.
+var linkPatterns = map[string][]*regexp.Regexp{
+	".md":       {markdownLink, markdownRef, htmlLink},
+	".markdown": {markdownLink, markdownRef, htmlLink},
+	".html":     {htmlLink},
+	".htm":      {htmlLink},
+	".yaml":     {quotedString, yamlValue},
+	".yml":      {quotedString, yamlValue},
+	".json":     {quotedString},
+	".toml":     {quotedString},
+	".ini":      {quotedString},
+	".cfg":      {quotedString},
+	".conf":     {quotedString},
+}
+
+// LinkEdit replaces a relative reference in a text file, broken because
+// the file or the one it refers to moved. Offset is the byte offset of Old
+// in the file, Line its line number.
+type LinkEdit struct {
+	File   string
+	Line   int
+	Offset int
+	Old    string
+	New    string
+}
+
+func (e LinkEdit) String() string {
+	return fmt.Sprintf("%s:%d: %s -> %s", e.File, e.Line, e.Old, e.New)
+}
+
+// movedPaths maps the paths of files and directories before a set of moves
+// to their paths after it, and back.
+type movedPaths struct {
+	to, from map[string]string
+}
+
+func newMovedPaths(moves map[string]string) movedPaths {
+	m := movedPaths{to: make(map[string]string), from: make(map[string]string)}
+	for oldpath, newpath := range moves {
+		oldpath, newpath = path.Clean(oldpath), path.Clean(newpath)
+		m.to[oldpath] = newpath
+		m.from[newpath] = oldpath
+	}
+	return m
+}
+
+// lookup maps name through moves, also when only one of its parents moved.
+func lookup(moves map[string]string, name string) string {
+	for dir := name; dir != "." && dir != "/" && !strings.HasPrefix(dir, ".."); dir = path.Dir(dir) {
+		if moved, ok := moves[dir]; ok {
+			return moved + strings.TrimPrefix(name, dir)
+		}
+	}
+	return name
+}
+
+// FindLinkEdits looks through Markdown, HTML and config files in fsys, after
+// moves from old to new paths have been applied, for relative references
+// the moves broke.
+func FindLinkEdits(fsys FS, moves map[string]string) ([]LinkEdit, error) {
+	moved := newMovedPaths(moves)
+
+	var edits []LinkEdit
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable directories hold no links that could be fixed.
+			return nil
+		}
+		patterns, ok := linkPatterns[strings.ToLower(path.Ext(name))]
+		if !ok || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxLinkFileSize {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		edits = append(edits, findFileLinkEdits(fsys, moved, name, data, patterns)...)
+		return nil
+	})
+	return edits, err
+}
+
+func findFileLinkEdits(fsys FS, moved movedPaths, name string, data []byte, patterns []*regexp.Regexp) []LinkEdit {
+	oldDir := path.Dir(lookup(moved.from, name))
+	newDir := path.Dir(name)
+
+	var edits []LinkEdit
+	seen := make(map[int]bool)
+	for _, pattern := range patterns {
+		for _, match := range pattern.FindAllSubmatchIndex(data, -1) {
+			start, end := match[2], match[3]
+			if seen[start] {
+				continue
+			}
+			seen[start] = true
+
+			ref := string(data[start:end])
+			if (pattern == quotedString || pattern == yamlValue) && !strings.ContainsAny(ref, "./") {
+				// A bare word in a config file is no path, even if a
+				// directory of that name moved.
+				continue
+			}
+			if updated, ok := updateLink(fsys, moved, oldDir, newDir, ref); ok {
+				edits = append(edits, LinkEdit{
+					File:   name,
+					Line:   bytes.Count(data[:start], []byte("\n")) + 1,
+					Offset: start,
+					Old:    ref,
+					New:    updated,
+				})
+			}
+		}
+	}
+	slices.SortFunc(edits, func(a, b LinkEdit) int { return a.Offset - b.Offset })
+	return edits
+}
+
+// updateLink returns ref, relative to a file moved from oldDir to newDir,
+// pointing to the same file as before the moves.
+func updateLink(fsys FS, moved movedPaths, oldDir, newDir, ref string) (string, bool) {
+	if ref == "" || strings.Contains(ref, "://") || strings.ContainsAny(ref[:1], "#/~") ||
+		strings.HasPrefix(ref, "mailto:") || strings.HasPrefix(ref, "data:") {
+		return "", false
+	}
+
+	target, suffix := ref, ""
+	if i := strings.IndexAny(ref, "?#"); i >= 0 {
+		target, suffix = ref[:i], ref[i:]
+	}
+	decoded, err := url.PathUnescape(target)
+	if err != nil || decoded == "" {
+		return "", false
+	}
+
+	oldTarget := path.Join(oldDir, decoded)
+	newTarget := lookup(moved.to, oldTarget)
+	if oldDir == newDir && oldTarget == newTarget {
+		return "", false
+	}
+	if !strings.HasPrefix(newTarget, "..") {
+		// Only rewrite what really refers to a file, config files are full
+		// of strings that merely look like paths.
+		if _, err := fsys.Lstat(newTarget); err != nil {
+			return "", false
+		}
+	}
+
+	rel, err := filepath.Rel(filepath.FromSlash(newDir), filepath.FromSlash(newTarget))
+	if err != nil {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	if strings.HasPrefix(target, "./") && !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+	if strings.HasSuffix(target, "/") {
+		rel += "/"
+	}
+	if decoded != target {
+		rel = (&url.URL{Path: rel}).EscapedPath()
+	}
+	if rel == target {
+		return "", false
+	}
+	return rel + suffix, true
+}
+
+// ApplyLinkEdits writes edits found by FindLinkEdits. A file that changed in
+// between is left alone and reported, one whose edits are already written,
+// by an earlier call that failed on another file, is skipped.
+func ApplyLinkEdits(fsys FS, edits []LinkEdit) error {
+	byFile := make(map[string][]LinkEdit)
+	var files []string
+	for _, e := range edits {
+		if _, ok := byFile[e.File]; !ok {
+			files = append(files, e.File)
+		}
+		byFile[e.File] = append(byFile[e.File], e)
+	}
+
+	var errs []error
+	for _, name := range files {
+		if err := applyFileLinkEdits(fsys, name, byFile[name]); err != nil {
+			errs = append(errs, fmt.Errorf("failed to update links in %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func applyFileLinkEdits(fsys FS, name string, edits []LinkEdit) error {
+	info, err := fsys.Stat(name)
+	if err != nil {
+		return err
+	}
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	if linkEditsWritten(data, edits) {
+		return nil
+	}
+
+	// Back to front, so that earlier offsets stay valid.
+	slices.SortFunc(edits, func(a, b LinkEdit) int { return b.Offset - a.Offset })
+	for _, e := range edits {
+		end := e.Offset + len(e.Old)
+		if end > len(data) || string(data[e.Offset:end]) != e.Old {
+			return fmt.Errorf("file changed since line %d was checked", e.Line)
+		}
+		data = slices.Concat(data[:e.Offset], []byte(e.New), data[end:])
+	}
+	return fsys.WriteFile(name, data, info.Mode().Perm())
+}
+
+// linkEditsWritten reports whether data has every one of edits in place,
+// each moved by the length change of the ones before it.
+func linkEditsWritten(data []byte, edits []LinkEdit) bool {
+	edits = slices.Clone(edits)
+	slices.SortFunc(edits, func(a, b LinkEdit) int { return a.Offset - b.Offset })
+	shift := 0
+	for _, e := range edits {
+		start := e.Offset + shift
+		end := start + len(e.New)
+		if start < 0 || end > len(data) || string(data[start:end]) != e.New {
+			return false
+		}
+		shift += len(e.New) - len(e.Old)
+	}
+	return true
+}
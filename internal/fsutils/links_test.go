@@ -0,0 +1,167 @@
+package fsutils
+
+import (
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+func TestLinkEdits(t *testing.T) {
+	fsys := NewMemFS()
+	files := map[string]string{
+		"notes/todo.md": "![logo](../img/a.png) and [spec](../spec.md#intro)\n" +
+			"[ref]: ./Final%20Report.pdf\n" +
+			"[web](https://example.com/img/a.png) [top](#top) [missing](gone.md)\n",
+		"notes/Final Report.pdf": "report",
+		"img/a.png":              "png",
+		"spec.md":                "see <a href=\"notes/todo.md\">todo</a>\n",
+		"site.yaml":              "logo: img/a.png\ntitle: img\nspec: \"spec.md\"\n",
+	}
+	for name, content := range files {
+		if err := fsys.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	moves := map[string]string{
+		"img/":                   "assets/img/",
+		"notes/todo.md":          "todo.md",
+		"notes/Final Report.pdf": "docs/Final Report.pdf",
+	}
+	for oldpath, newpath := range moves {
+		if err := CreateDir(fsys, "assets/"); err != nil {
+			t.Fatal(err)
+		}
+		if err := CreateDir(fsys, "docs/"); err != nil {
+			t.Fatal(err)
+		}
+		if err := MoveFile(fsys, oldpath, newpath); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	edits, err := FindLinkEdits(fsys, moves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range edits {
+		got = append(got, e.String())
+	}
+	expected := []string{
+		"site.yaml:1: img/a.png -> assets/img/a.png",
+		"spec.md:1: notes/todo.md -> todo.md",
+		"todo.md:1: ../img/a.png -> assets/img/a.png",
+		"todo.md:1: ../spec.md#intro -> spec.md#intro",
+		"todo.md:2: ./Final%20Report.pdf -> ./docs/Final%20Report.pdf",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("\nexpected: %q\ngot:      %q", expected, got)
+	}
+
+	if err := ApplyLinkEdits(fsys, edits); err != nil {
+		t.Fatal(err)
+	}
+	b, err := fs.ReadFile(fsys, "todo.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTodo := "![logo](assets/img/a.png) and [spec](spec.md#intro)\n" +
+		"[ref]: ./docs/Final%20Report.pdf\n" +
+		"[web](https://example.com/img/a.png) [top](#top) [missing](gone.md)\n"
+	if string(b) != expectedTodo {
+		t.Fatalf("\nexpected:\n%s\ngot:\n%s\n", expectedTodo, b)
+	}
+
+	if edits, err := FindLinkEdits(fsys, moves); err != nil || len(edits) != 0 {
+		t.Fatalf("expected no edits left, got: %v %v", edits, err)
+	}
+}
+
+func TestApplyLinkEditsChangedFile(t *testing.T) {
+	fsys := NewMemFS()
+	fsys.WriteFile("a.md", []byte("[b](b.md)\n"), 0644)
+	fsys.WriteFile("dir/b.md", nil, 0644)
+
+	edits, err := FindLinkEdits(fsys, map[string]string{"b.md": "dir/b.md"})
+	if err != nil || len(edits) != 1 {
+		t.Fatalf("expected one edit, got: %v %v", edits, err)
+	}
+	fsys.WriteFile("a.md", []byte("rewritten [b](b.md)\n"), 0644)
+	if err := ApplyLinkEdits(fsys, edits); err == nil {
+		t.Fatal("expected an error for a file changed in between")
+	}
+}
+
+func TestApplyLinkEditsAgain(t *testing.T) {
+	fsys := NewMemFS()
+	fsys.WriteFile("a.md", []byte("[b](b.md) [c](c.md)\n"), 0644)
+	fsys.WriteFile("z.md", []byte("[b](b.md)\n"), 0644)
+	fsys.WriteFile("dir/b.md", nil, 0644)
+	fsys.WriteFile("dir/c.md", nil, 0644)
+
+	edits, err := FindLinkEdits(fsys, map[string]string{"b.md": "dir/b.md", "c.md": "dir/c.md"})
+	if err != nil || len(edits) != 3 {
+		t.Fatalf("expected three edits, got: %v %v", edits, err)
+	}
+	// a.md is updated, z.md changed in between.
+	fsys.WriteFile("z.md", []byte("rewritten [b](b.md)\n"), 0644)
+	if err := ApplyLinkEdits(fsys, edits); err == nil {
+		t.Fatal("expected an error for a file changed in between")
+	}
+
+	// Once z.md is back, applying again skips a.md, already updated.
+	fsys.WriteFile("z.md", []byte("[b](b.md)\n"), 0644)
+	if err := ApplyLinkEdits(fsys, edits); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{
+		"a.md": "[b](dir/b.md) [c](dir/c.md)\n",
+		"z.md": "[b](dir/b.md)\n",
+	} {
+		if b, _ := fs.ReadFile(fsys, name); string(b) != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, b)
+		}
+	}
+}
+
+func TestJournalUndoLinkEdits(t *testing.T) {
+	base := NewMemFS()
+	base.WriteFile("a.md", []byte("[b](b.md)\n"), 0644)
+	base.WriteFile("b.md", nil, 0644)
+
+	journal := NewJournal(t.TempDir(), "mem://test")
+	fsys := WithJournal(base, journal)
+	if err := CreateDir(fsys, "dir/"); err != nil {
+		t.Fatal(err)
+	}
+	moves := map[string]string{"b.md": "dir/b.md"}
+	if err := MoveFile(fsys, "b.md", "dir/b.md"); err != nil {
+		t.Fatal(err)
+	}
+	edits, err := FindLinkEdits(fsys, moves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyLinkEdits(fsys, edits); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := fs.ReadFile(base, "a.md"); string(b) != "[b](dir/b.md)\n" {
+		t.Fatalf("unexpected contents: %s", b)
+	}
+	journal.Close()
+
+	_, entries, err := ReadJournal(journal.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Undo(base, entries); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := fs.ReadFile(base, "a.md"); string(b) != "[b](b.md)\n" {
+		t.Fatalf("expected contents to be restored, got: %s", b)
+	}
+	if _, err := base.Stat("b.md"); err != nil {
+		t.Fatal(err)
+	}
+}
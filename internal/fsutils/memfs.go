@@ -0,0 +1,296 @@
+package fsutils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemFS is an FS kept entirely in memory. It starts out as an empty root
+// directory.
+type MemFS struct {
+	mu      sync.RWMutex
+	nodes   map[string]*memNode
+	changed bool
+}
+
+type memNode struct {
+	mode    fs.FileMode
+	modTime time.Time
+	data    []byte
+}
+
+func NewMemFS() *MemFS {
+	return &MemFS{
+		nodes: map[string]*memNode{
+			".": {mode: fs.ModeDir | 0755, modTime: time.Now()},
+		},
+	}
+}
+
+// NewSampleFS returns a MemFS holding the tree tests share: three files and
+// two directories with two files each, every file holding its own name.
+func NewSampleFS() *MemFS {
+	m := NewMemFS()
+	for _, name := range []string{
+		"Dir/test_file_1.txt",
+		"Dir/test_file_2.txt",
+		"Dir2/test_file_1.txt",
+		"Dir2/test_file_2.txt",
+		"test_file.txt",
+		"test_file_2.txt",
+		"test_file_3.txt",
+	} {
+		m.WriteFile(name, []byte(name), 0644)
+	}
+	return m
+}
+
+// Changed reports whether anything was written, moved or removed since the
+// MemFS was created or loaded.
+func (m *MemFS) Changed() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.changed
+}
+
+// add puts a node at name, creating missing parents, without counting it
+// as a change.
+func (m *MemFS) add(name string, mode fs.FileMode, modTime time.Time, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if _, ok := m.nodes[dir]; ok {
+			break
+		}
+		m.nodes[dir] = &memNode{mode: fs.ModeDir | 0755, modTime: modTime}
+	}
+	if n, ok := m.nodes[name]; ok && n.mode.IsDir() && mode.IsDir() {
+		n.mode, n.modTime = mode, modTime
+		return
+	}
+	m.nodes[name] = &memNode{mode: mode, modTime: modTime, data: data}
+}
+
+// WriteFile creates or replaces the file name, creating missing parents.
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := m.MkdirAll(path.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n, ok := m.nodes[name]; ok && n.mode.IsDir() {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrExist}
+	}
+	m.nodes[name] = &memNode{mode: perm.Perm(), modTime: time.Now(), data: slices.Clone(data)}
+	m.changed = true
+	return nil
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	n, ok := m.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	info := memFileInfo{name: path.Base(name), node: n}
+	if n.mode.IsDir() {
+		return &memDir{info: info, entries: m.entries(name)}, nil
+	}
+	return &memFile{info: info, Reader: bytes.NewReader(n.data)}, nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	n, ok := m.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	if !n.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return m.entries(name), nil
+}
+
+// entries lists the children of dir sorted by name. The caller holds m.mu.
+func (m *MemFS) entries(dir string) []fs.DirEntry {
+	var entries []fs.DirEntry
+	for p, n := range m.nodes {
+		if p != "." && path.Dir(p) == dir {
+			entries = append(entries, fs.FileInfoToDirEntry(memFileInfo{name: path.Base(p), node: n}))
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	n, ok := m.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return memFileInfo{name: path.Base(name), node: n}, nil
+}
+
+// Lstat is the same as Stat, MemFS has no symlinks.
+func (m *MemFS) Lstat(name string) (fs.FileInfo, error) {
+	return m.Stat(name)
+}
+
+func (m *MemFS) Rename(oldpath, newpath string) error {
+	if !fs.ValidPath(oldpath) || !fs.ValidPath(newpath) || oldpath == "." || newpath == "." {
+		return &fs.PathError{Op: "rename", Path: oldpath, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.nodes[oldpath]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldpath, Err: fs.ErrNotExist}
+	}
+	if _, ok := m.nodes[newpath]; ok {
+		return &fs.PathError{Op: "rename", Path: newpath, Err: fs.ErrExist}
+	}
+	if parent, ok := m.nodes[path.Dir(newpath)]; !ok || !parent.mode.IsDir() {
+		return &fs.PathError{Op: "rename", Path: newpath, Err: fs.ErrNotExist}
+	}
+	if n.mode.IsDir() && strings.HasPrefix(newpath, oldpath+"/") {
+		return &fs.PathError{Op: "rename", Path: newpath, Err: fs.ErrInvalid}
+	}
+
+	for p, child := range m.nodes {
+		if strings.HasPrefix(p, oldpath+"/") {
+			delete(m.nodes, p)
+			m.nodes[newpath+strings.TrimPrefix(p, oldpath)] = child
+		}
+	}
+	delete(m.nodes, oldpath)
+	m.nodes[newpath] = n
+	m.changed = true
+	return nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := ""
+	for _, part := range strings.Split(name, "/") {
+		p = path.Join(p, part)
+		n, ok := m.nodes[p]
+		if !ok {
+			m.nodes[p] = &memNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+			m.changed = true
+		} else if !n.mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: p, Err: fs.ErrExist}
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.nodes[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	for p := range m.nodes {
+		if strings.HasPrefix(p, name+"/") {
+			return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+		}
+	}
+	delete(m.nodes, name)
+	m.changed = true
+	return nil
+}
+
+func (m *MemFS) SameFile(fi1, fi2 fs.FileInfo) bool {
+	n1, ok1 := fi1.Sys().(*memNode)
+	n2, ok2 := fi2.Sys().(*memNode)
+	return ok1 && ok2 && n1 == n2
+}
+
+type memFileInfo struct {
+	name string
+	node *memNode
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return int64(len(i.node.data)) }
+func (i memFileInfo) Mode() fs.FileMode  { return i.node.mode }
+func (i memFileInfo) ModTime() time.Time { return i.node.modTime }
+func (i memFileInfo) IsDir() bool        { return i.node.mode.IsDir() }
+func (i memFileInfo) Sys() any           { return i.node }
+
+type memFile struct {
+	info memFileInfo
+	*bytes.Reader
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memFile) Close() error               { return nil }
+
+type memDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memDir) Close() error               { return nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: fs.ErrInvalid}
+}
+
+func (d *memDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if count <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(rest) {
+		count = len(rest)
+	}
+	d.offset += count
+	return rest[:count], nil
+}
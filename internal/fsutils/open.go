@@ -0,0 +1,46 @@
+package fsutils
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// Open returns the filesystem for target, which is a local directory or a
+// URL of a remote one, and the closer releasing its connection.
+func Open(target string) (FS, io.Closer, error) {
+	if dir, ok := LocalDir(target); ok {
+		return DirFS(dir), nopCloser{}, nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch u.Scheme {
+	case "sftp":
+		return DialSFTP(u)
+	case "s3":
+		fsys, err := DialS3(u)
+		return fsys, nopCloser{}, err
+	}
+	return nil, nil, fmt.Errorf("unsupported target: %s", target)
+}
+
+// LocalDir returns the directory on the local disk target names, if any.
+func LocalDir(target string) (string, bool) {
+	if !strings.Contains(target, "://") {
+		return target, true
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+	return filepath.FromSlash(u.Path), true
+}
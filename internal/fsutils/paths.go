@@ -0,0 +1,45 @@
+package fsutils
+
+import (
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// PathDiff describes how two spellings of a path relate to each other.
+type PathDiff int
+
+const (
+	DifferentPaths PathDiff = iota
+	IdenticalPaths
+	// NormalizationOnly paths differ only in Unicode normalization form,
+	// e.g. a precomposed "é" (NFC) against "e" + combining accent (NFD).
+	NormalizationOnly
+	// CaseOnly paths differ in letter case and possibly normalization.
+	CaseOnly
+)
+
+var fold = cases.Fold()
+
+// NormKey returns p in Unicode NFC, so that spellings which differ only in
+// normalization compare equal.
+func NormKey(p string) string {
+	return norm.NFC.String(p)
+}
+
+// FoldKey returns p in NFC and case folded, so that spellings a case
+// insensitive filesystem treats as the same file compare equal.
+func FoldKey(p string) string {
+	return fold.String(NormKey(p))
+}
+
+func ComparePaths(a, b string) PathDiff {
+	switch {
+	case a == b:
+		return IdenticalPaths
+	case NormKey(a) == NormKey(b):
+		return NormalizationOnly
+	case FoldKey(a) == FoldKey(b):
+		return CaseOnly
+	}
+	return DifferentPaths
+}
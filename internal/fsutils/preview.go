@@ -0,0 +1,230 @@
+package fsutils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// previewLines and previewEntries limit what a preview lists of a text
+	// file, an archive or a directory.
+	previewLines   = 20
+	previewEntries = 20
+	// maxPreviewText is how much of a text file is read for its first lines.
+	maxPreviewText = 64 << 10
+	// maxPreviewZip keeps huge zip files, which have to be read whole when
+	// the filesystem cannot seek, out of the preview.
+	maxPreviewZip = 64 << 20
+)
+
+// Preview describes a file or directory, for a quick look at what it is.
+type Preview struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	Mode    fs.FileMode
+	MIME    string
+	// Lines holds the first lines of a text file.
+	Lines []string
+	// Width and Height are the dimensions of an image.
+	Width, Height int
+	// Entries holds the first entries of an archive or a directory, Total
+	// counts all of them.
+	Entries []string
+	Total   int
+}
+
+// ReadPreview looks into name for what Preview tells about it. Contents it
+// cannot make sense of are left out rather than reported as errors.
+func ReadPreview(fsys FS, name string) (Preview, error) {
+	info, err := fsys.Lstat(name)
+	if err != nil {
+		return Preview{}, err
+	}
+	p := Preview{Name: name, Size: info.Size(), ModTime: info.ModTime(), Mode: info.Mode()}
+
+	switch {
+	case info.IsDir():
+		p.MIME = "inode/directory"
+		entries, err := fsys.ReadDir(name)
+		if err != nil {
+			return p, err
+		}
+		p.Total = len(entries)
+		for _, e := range entries[:min(len(entries), previewEntries)] {
+			entry := e.Name()
+			if e.IsDir() {
+				entry += "/"
+			}
+			p.Entries = append(p.Entries, entry)
+		}
+		return p, nil
+	case !info.Mode().IsRegular():
+		return p, nil
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return p, err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return p, err
+	}
+	head = head[:n]
+	p.MIME = mimeType(name, head)
+
+	switch {
+	case strings.HasPrefix(p.MIME, "image/"):
+		if config, _, err := image.DecodeConfig(io.MultiReader(bytes.NewReader(head), f)); err == nil {
+			p.Width, p.Height = config.Width, config.Height
+		}
+	case formatOf(name) != notArchive:
+		p.Entries, p.Total = listArchive(fsys, name, info.Size())
+	case isText(p.MIME, head):
+		p.Lines = firstLines(io.MultiReader(bytes.NewReader(head), f))
+	}
+	return p, nil
+}
+
+// mimeType prefers what the contents tell over what the extension does,
+// unless the contents only look like generic text or binary data.
+func mimeType(name string, head []byte) string {
+	sniffed := http.DetectContentType(head)
+	if sniffed != "application/octet-stream" && !strings.HasPrefix(sniffed, "text/plain") {
+		return sniffed
+	}
+	if byExt := mime.TypeByExtension(path.Ext(name)); byExt != "" {
+		return byExt
+	}
+	return sniffed
+}
+
+func isText(mimeType string, head []byte) bool {
+	if strings.HasPrefix(mimeType, "text/") || strings.HasSuffix(mimeType, "json") ||
+		strings.HasSuffix(mimeType, "xml") || strings.HasSuffix(mimeType, "yaml") {
+		return true
+	}
+	// A multi-byte character cut off at the end of head is still text.
+	for cut := 0; cut < utf8.UTFMax-1 && len(head) > 0 && !utf8.Valid(head); cut++ {
+		head = head[:len(head)-1]
+	}
+	return len(head) > 0 && utf8.Valid(head) && !bytes.ContainsRune(head, 0)
+}
+
+func firstLines(r io.Reader) []string {
+	scanner := bufio.NewScanner(io.LimitReader(r, maxPreviewText))
+	scanner.Buffer(make([]byte, 0, 4096), maxPreviewText)
+	var lines []string
+	for len(lines) < previewLines && scanner.Scan() {
+		lines = append(lines, printable(strings.ReplaceAll(scanner.Text(), "\t", "    ")))
+	}
+	return lines
+}
+
+// printable replaces escape sequences and other control characters, which
+// would reach the terminal as they are, with a question mark.
+func printable(s string) string {
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsPrint(r) && r != ' ' {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+// listArchive returns the first entries of an archive and how many there
+// are, or nothing if it cannot be read.
+func listArchive(fsys FS, name string, size int64) ([]string, int) {
+	var names []string
+	var err error
+	if formatOf(name) == zipArchive {
+		names, err = zipNames(fsys, name, size)
+	} else {
+		names, err = tarNames(fsys, name)
+	}
+	if err != nil {
+		return nil, 0
+	}
+	return names[:min(len(names), previewEntries)], len(names)
+}
+
+func zipNames(fsys FS, name string, size int64) ([]string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, ok := f.(io.ReaderAt)
+	if !ok {
+		if size > maxPreviewZip {
+			return nil, fmt.Errorf("%s is too large to list", name)
+		}
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(zr.File))
+	for _, zf := range zr.File {
+		names = append(names, zf.Name)
+	}
+	return names, nil
+}
+
+func tarNames(fsys FS, name string) ([]string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if formatOf(name) == tarGzArchive {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var names []string
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return names, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, hdr.Name)
+	}
+}
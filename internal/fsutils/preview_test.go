@@ -0,0 +1,69 @@
+package fsutils
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadPreview(t *testing.T) {
+	fsys := NewMemFS()
+	if err := fsys.WriteFile("docs/notes.txt", []byte("first\n\tsecond\nthird\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile("build-output", []byte("\x1b[31mFAIL\x1b[0m caf\xc3\xa9\r\n\x07done\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Binary data that happens to be valid UTF-8 but the last bytes.
+	if err := fsys.WriteFile("blob.bin", []byte("abcdefgh\xff\xfe\xfd\xfc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 32, 16))); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile("logo.png", img.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	zipName := filepath.Join(t.TempDir(), "bundle.zip")
+	writeTestZip(t, zipName, "bundle/README.md", "bundle/img/logo.png")
+	data, err := os.ReadFile(zipName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile("bundle.zip", data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		expected Preview
+	}{
+		{"docs/notes.txt", Preview{MIME: "text/plain; charset=utf-8", Lines: []string{"first", "    second", "third"}}},
+		{"build-output", Preview{MIME: "application/octet-stream", Lines: []string{"?[31mFAIL?[0m café", "?done"}}},
+		{"blob.bin", Preview{MIME: "application/octet-stream"}},
+		{"logo.png", Preview{MIME: "image/png", Width: 32, Height: 16}},
+		{"bundle.zip", Preview{MIME: "application/zip", Entries: []string{"bundle/README.md", "bundle/img/logo.png"}, Total: 2}},
+		{"docs", Preview{MIME: "inode/directory", Entries: []string{"notes.txt"}, Total: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadPreview(fsys, tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Only what was read from the contents is compared.
+			got.Name, got.Size, got.ModTime, got.Mode = "", 0, time.Time{}, 0
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Fatalf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package fsutils
+
+import (
+	"os"
+	"syscall"
+)
+
+// linkRename moves oldpath to newpath without ever replacing newpath.
+// Files are hard linked to the destination and then unlinked, and link
+// fails if the destination already exists. Directories cannot be hard
+// linked, so an empty placeholder is created first to claim the name; a
+// directory may only be renamed over an empty one, so anything written
+// into the placeholder in the meantime makes the rename fail.
+func linkRename(oldpath, newpath string) error {
+	info, err := os.Lstat(oldpath)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		if err := os.Mkdir(newpath, info.Mode().Perm()); err != nil {
+			return err
+		}
+		// os.Rename refuses any existing directory as destination, so go
+		// straight to the syscall which accepts an empty one.
+		if err := syscall.Rename(oldpath, newpath); err != nil {
+			os.Remove(newpath)
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+		}
+		return nil
+	}
+
+	if err := os.Link(oldpath, newpath); err != nil {
+		return err
+	}
+	return os.Remove(oldpath)
+}
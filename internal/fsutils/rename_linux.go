@@ -0,0 +1,25 @@
+//go:build linux
+
+package fsutils
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// renameNoReplace renames oldpath to newpath in a single renameat2 call with
+// RENAME_NOREPLACE, so the kernel refuses to clobber a destination created
+// after any earlier check. Kernels and filesystems without support for the
+// flag fall back to linkRename.
+func renameNoReplace(oldpath, newpath string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, oldpath, unix.AT_FDCWD, newpath, unix.RENAME_NOREPLACE)
+	if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EINVAL) {
+		return linkRename(oldpath, newpath)
+	}
+	if err != nil {
+		return &os.LinkError{Op: "renameat2", Old: oldpath, New: newpath, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package fsutils
+
+func renameNoReplace(oldpath, newpath string) error {
+	return linkRename(oldpath, newpath)
+}
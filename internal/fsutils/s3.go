@@ -0,0 +1,292 @@
+package fsutils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3FS maps a bucket onto a directory tree. Object keys below prefix are
+// files, and every key prefix up to a "/" is a directory, whether or not a
+// folder marker object exists for it.
+type s3FS struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// S3FS returns the objects of bucket whose keys start with prefix.
+func S3FS(client *minio.Client, bucket, prefix string) FS {
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return s3FS{client: client, bucket: bucket, prefix: prefix}
+}
+
+func (f s3FS) key(name string) string {
+	if name == "." {
+		return strings.TrimSuffix(f.prefix, "/")
+	}
+	return f.prefix + name
+}
+
+// dirKey is the prefix all keys inside the directory name start with.
+func (f s3FS) dirKey(name string) string {
+	if name == "." {
+		return f.prefix
+	}
+	return f.prefix + name + "/"
+}
+
+func (f s3FS) Open(name string) (fs.File, error) {
+	info, err := f.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		entries, err := f.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &memDir{info: info, entries: entries}, nil
+	}
+	obj, err := f.client.GetObject(context.Background(), f.bucket, f.key(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return s3File{Object: obj, info: info}, nil
+}
+
+func (f s3FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	dir := f.dirKey(name)
+
+	var entries []fs.DirEntry
+	for obj := range f.client.ListObjects(context.Background(), f.bucket, minio.ListObjectsOptions{Prefix: dir}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		if obj.Key == dir {
+			continue // folder marker of the directory itself
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(s3FileInfo{name: path.Base(obj.Key), obj: obj}))
+	}
+	if entries == nil && name != "." {
+		if _, err := f.Stat(name); err != nil {
+			return nil, err
+		}
+	}
+	// Listings return objects and common prefixes as separate groups.
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries, nil
+}
+
+func (f s3FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return s3FileInfo{name: ".", obj: minio.ObjectInfo{Key: f.prefix}}, nil
+	}
+
+	// Cancelling stops the listing below once the first key arrived.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	obj, err := f.client.StatObject(ctx, f.bucket, f.key(name), minio.StatObjectOptions{})
+	if err == nil {
+		return s3FileInfo{name: path.Base(name), obj: obj}, nil
+	}
+	if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+		return nil, err
+	}
+
+	dir := f.dirKey(name)
+	for obj := range f.client.ListObjects(ctx, f.bucket, minio.ListObjectsOptions{Prefix: dir, MaxKeys: 1}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		return s3FileInfo{name: path.Base(name), obj: minio.ObjectInfo{Key: dir}}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// Lstat is the same as Stat, object storage has no symlinks.
+func (f s3FS) Lstat(name string) (fs.FileInfo, error) {
+	return f.Stat(name)
+}
+
+// maxCopySize is the largest object a single server side copy can make,
+// larger ones are copied in parts.
+const maxCopySize = 5 << 30
+
+// Rename copies every object server side and verifies the copies before
+// deleting any of the originals, so a failure leaves the source complete.
+// The copies made before a failure are deleted again.
+func (f s3FS) Rename(oldpath, newpath string) error {
+	if _, err := f.Stat(newpath); err == nil {
+		return &fs.PathError{Op: "rename", Path: newpath, Err: fs.ErrExist}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	info, err := f.Stat(oldpath)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	moves := map[string]string{f.key(oldpath): f.key(newpath)}
+	if info.IsDir() {
+		moves = make(map[string]string)
+		src, dst := f.dirKey(oldpath), f.dirKey(newpath)
+		for obj := range f.client.ListObjects(ctx, f.bucket, minio.ListObjectsOptions{Prefix: src, Recursive: true}) {
+			if obj.Err != nil {
+				return obj.Err
+			}
+			moves[obj.Key] = dst + strings.TrimPrefix(obj.Key, src)
+		}
+	}
+
+	srcs := slices.Sorted(maps.Keys(moves))
+	for i, src := range srcs {
+		if err := f.copyVerified(ctx, src, moves[src]); err != nil {
+			for _, done := range srcs[:i+1] {
+				// A copy left behind would be in the way of a retry.
+				if rerr := f.client.RemoveObject(ctx, f.bucket, moves[done], minio.RemoveObjectOptions{}); rerr != nil {
+					err = errors.Join(err, rerr)
+				}
+			}
+			return &os.LinkError{Op: "copy", Old: src, New: moves[src], Err: err}
+		}
+	}
+	for src := range moves {
+		if err := f.client.RemoveObject(ctx, f.bucket, src, minio.RemoveObjectOptions{}); err != nil {
+			return &fs.PathError{Op: "delete", Path: src, Err: err}
+		}
+	}
+	return nil
+}
+
+func (f s3FS) copyVerified(ctx context.Context, src, dst string) error {
+	orig, err := f.client.StatObject(ctx, f.bucket, src, minio.StatObjectOptions{})
+	if err != nil {
+		return err
+	}
+	dstOpts := minio.CopyDestOptions{Bucket: f.bucket, Object: dst}
+	srcOpts := minio.CopySrcOptions{Bucket: f.bucket, Object: src, MatchETag: orig.ETag}
+	if orig.Size > maxCopySize {
+		_, err = f.client.ComposeObject(ctx, dstOpts, srcOpts)
+	} else {
+		_, err = f.client.CopyObject(ctx, dstOpts, srcOpts)
+	}
+	if err != nil {
+		return err
+	}
+
+	copied, err := f.client.StatObject(ctx, f.bucket, dst, minio.StatObjectOptions{})
+	if err != nil {
+		return err
+	}
+	// ETags of multipart uploads are not content hashes and change on copy.
+	multipart := strings.Contains(orig.ETag, "-") || strings.Contains(copied.ETag, "-")
+	if copied.Size != orig.Size || (!multipart && copied.ETag != orig.ETag) {
+		return fmt.Errorf("copy does not match the original: size %d, etag %s", copied.Size, copied.ETag)
+	}
+	return nil
+}
+
+// MkdirAll does nothing, directories exist as long as keys start with them.
+func (f s3FS) MkdirAll(string, fs.FileMode) error {
+	return nil
+}
+
+// WriteFile uploads data as the object name. Objects have no permissions.
+func (f s3FS) WriteFile(name string, data []byte, _ fs.FileMode) error {
+	_, err := f.client.PutObject(context.Background(), f.bucket, f.key(name), bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{})
+	return err
+}
+
+// Remove deletes an object. Directories have nothing to delete.
+func (f s3FS) Remove(name string) error {
+	info, err := f.Stat(name)
+	if err != nil || info.IsDir() {
+		return err
+	}
+	return f.client.RemoveObject(context.Background(), f.bucket, f.key(name), minio.RemoveObjectOptions{})
+}
+
+func (f s3FS) SameFile(fi1, fi2 fs.FileInfo) bool {
+	o1, ok1 := fi1.Sys().(minio.ObjectInfo)
+	o2, ok2 := fi2.Sys().(minio.ObjectInfo)
+	return ok1 && ok2 && o1.Key == o2.Key
+}
+
+type s3FileInfo struct {
+	name string
+	obj  minio.ObjectInfo
+}
+
+func (i s3FileInfo) Name() string       { return i.name }
+func (i s3FileInfo) Size() int64        { return i.obj.Size }
+func (i s3FileInfo) ModTime() time.Time { return i.obj.LastModified }
+func (i s3FileInfo) IsDir() bool        { return i.obj.Key == "" || strings.HasSuffix(i.obj.Key, "/") }
+func (i s3FileInfo) Sys() any           { return i.obj }
+
+func (i s3FileInfo) Mode() fs.FileMode {
+	if i.IsDir() {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+type s3File struct {
+	*minio.Object
+	info fs.FileInfo
+}
+
+func (f s3File) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// DialS3 connects to an s3://bucket/prefix URL. The endpoint is taken from
+// S3_ENDPOINT, e.g. "http://localhost:9000" for a local MinIO, and defaults
+// to AWS. Credentials come from the usual AWS or MinIO environment variables
+// or ~/.aws/credentials.
+func DialS3(u *url.URL) (FS, error) {
+	endpoint := &url.URL{Scheme: "https", Host: "s3.amazonaws.com"}
+	if e := os.Getenv("S3_ENDPOINT"); e != "" {
+		var err error
+		if endpoint, err = url.Parse(e); err != nil {
+			return nil, fmt.Errorf("invalid S3_ENDPOINT: %w", err)
+		}
+	}
+
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+		}),
+		Secure: endpoint.Scheme != "http",
+		Region: os.Getenv("AWS_REGION"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return S3FS(client, u.Host, u.Path), nil
+}
@@ -0,0 +1,292 @@
+package fsutils
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// fakeS3 is a single bucket stand-in for an S3 compatible server. It speaks
+// just enough of the protocol for S3FS: listing, stat, get, put, copy and
+// delete.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	// corrupt makes server side copies lose their last byte, corruptKey
+	// only those of one key.
+	corrupt    bool
+	corruptKey string
+}
+
+type fakeListResult struct {
+	XMLName        xml.Name `xml:"ListBucketResult"`
+	Name           string
+	Prefix         string
+	Delimiter      string
+	IsTruncated    bool
+	KeyCount       int
+	Contents       []fakeObject
+	CommonPrefixes []fakePrefix
+}
+
+type fakeObject struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+}
+
+type fakePrefix struct {
+	Prefix string
+}
+
+var fakeModTime = time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	data, exists := s.objects[key]
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		s.list(w, bucket, r.URL.Query())
+	case !exists && (r.Method == http.MethodHead || r.Method == http.MethodGet):
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", fakeModTime.Format(http.TimeFormat))
+		w.Header().Set("ETag", etag(data))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		src, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		src = strings.TrimPrefix(strings.TrimPrefix(src, "/"), bucket+"/")
+		copied := append([]byte(nil), s.objects[src]...)
+		if (s.corrupt || src == s.corruptKey) && len(copied) > 0 {
+			copied = copied[:len(copied)-1]
+		}
+		s.objects[key] = copied
+		w.Write([]byte(`<CopyObjectResult><LastModified>` + fakeModTime.Format(time.RFC3339) +
+			`</LastModified><ETag>` + etag(copied) + `</ETag></CopyObjectResult>`))
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			data = decodeChunked(data)
+		}
+		s.objects[key] = data
+		w.Header().Set("ETag", etag(data))
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// decodeChunked strips the signatures of an aws-chunked upload, a chunk is
+// "<hex size>;chunk-signature=<signature>\r\n<data>\r\n".
+func decodeChunked(body []byte) []byte {
+	var data []byte
+	for {
+		header, rest, ok := strings.Cut(string(body), "\r\n")
+		size, err := strconv.ParseInt(strings.SplitN(header, ";", 2)[0], 16, 64)
+		if !ok || err != nil || size == 0 || int(size) > len(rest) {
+			return data
+		}
+		data = append(data, rest[:size]...)
+		body = []byte(strings.TrimPrefix(rest[size:], "\r\n"))
+	}
+}
+
+func (s *fakeS3) list(w http.ResponseWriter, bucket string, query url.Values) {
+	result := fakeListResult{Name: bucket, Prefix: query.Get("prefix"), Delimiter: query.Get("delimiter")}
+	prefixes := make(map[string]bool)
+	for key, data := range s.objects {
+		rest, ok := strings.CutPrefix(key, result.Prefix)
+		if !ok {
+			continue
+		}
+		if i := strings.Index(rest, "/"); result.Delimiter == "/" && i >= 0 && i < len(rest)-1 {
+			prefixes[result.Prefix+rest[:i+1]] = true
+			continue
+		}
+		result.Contents = append(result.Contents, fakeObject{
+			Key:          key,
+			LastModified: fakeModTime.Format(time.RFC3339),
+			ETag:         etag(data),
+			Size:         len(data),
+		})
+	}
+	for p := range prefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, fakePrefix{Prefix: p})
+	}
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	sort.Slice(result.CommonPrefixes, func(i, j int) bool { return result.CommonPrefixes[i].Prefix < result.CommonPrefixes[j].Prefix })
+	result.KeyCount = len(result.Contents) + len(result.CommonPrefixes)
+
+	xml.NewEncoder(w).Encode(result)
+}
+
+func testS3(t *testing.T, keys ...string) (*fakeS3, FS) {
+	t.Helper()
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	for _, key := range keys {
+		fake.objects[key] = []byte(key)
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client, err := minio.New(strings.TrimPrefix(server.URL, "http://"), &minio.Options{
+		Creds:        credentials.NewStaticV4("norbot", "secret", ""),
+		Region:       "us-east-1",
+		BucketLookup: minio.BucketLookupPath,
+		MaxRetries:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, S3FS(client, "bucket", "mess")
+}
+
+func TestS3FS(t *testing.T) {
+	fake, fsys := testS3(t,
+		"mess/IMG 1.jpg",
+		"mess/notes.txt",
+		"mess/docs/old.pdf",
+		"mess/docs/2023/tax.pdf",
+		"other/untouched.txt",
+	)
+
+	files, err := ReadDir(fsys, ".", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedOutput := `IMG 1.jpg
+docs/
+docs/2023/
+docs/2023/tax.pdf
+docs/old.pdf
+notes.txt
+`
+	if output := files.String(); output != expectedOutput {
+		t.Fatalf("\nexpected:\n%s\ngot:\n%s\n", expectedOutput, output)
+	}
+
+	if err := CreateDir(fsys, "photos/2024/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveFile(fsys, "IMG 1.jpg", "photos/2024/img_1.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveFile(fsys, "docs/", "archive/docs/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveFile(fsys, "notes.txt", "photos/2024/img_1.jpg"); !errors.Is(err, ErrDestinationExists) {
+		t.Fatalf("expected: %v got: %v", ErrDestinationExists, err)
+	}
+
+	var keys []string
+	for key := range fake.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	expectedKeys := []string{
+		"mess/archive/docs/2023/tax.pdf",
+		"mess/archive/docs/old.pdf",
+		"mess/notes.txt",
+		"mess/photos/2024/img_1.jpg",
+		"other/untouched.txt",
+	}
+	if strings.Join(keys, "\n") != strings.Join(expectedKeys, "\n") {
+		t.Fatalf("expected: %v got: %v", expectedKeys, keys)
+	}
+
+	b, err := fs.ReadFile(fsys, "photos/2024/img_1.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "mess/IMG 1.jpg" {
+		t.Fatalf("unexpected content: %s", b)
+	}
+
+	if err := fsys.WriteFile("notes.txt", []byte("[photo](photos/2024/img_1.jpg)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if string(fake.objects["mess/notes.txt"]) != "[photo](photos/2024/img_1.jpg)" {
+		t.Fatalf("unexpected content: %s", fake.objects["mess/notes.txt"])
+	}
+}
+
+func TestS3FSVerifiesCopies(t *testing.T) {
+	fake, fsys := testS3(t, "mess/notes.txt")
+	fake.corrupt = true
+
+	if err := MoveFile(fsys, "notes.txt", "texts/notes.txt"); err == nil {
+		t.Fatal("expected move to fail")
+	}
+
+	f, err := fsys.Open("notes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "mess/notes.txt" {
+		t.Fatalf("source damaged: %s", b)
+	}
+}
+
+func TestS3FSRenameCleansUp(t *testing.T) {
+	fake, fsys := testS3(t, "mess/Dir/a.txt", "mess/Dir/b.txt", "mess/Dir/c.txt")
+	fake.corruptKey = "mess/Dir/b.txt"
+
+	if err := fsys.Rename("Dir", "Texts"); err == nil {
+		t.Fatal("expected rename to fail")
+	}
+	for key := range fake.objects {
+		if strings.HasPrefix(key, "mess/Texts/") {
+			t.Errorf("copy left behind: %s", key)
+		}
+	}
+
+	// Nothing is in the way of trying again.
+	fake.corruptKey = ""
+	if err := fsys.Rename("Dir", "Texts"); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for key := range fake.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	expected := []string{"mess/Texts/a.txt", "mess/Texts/b.txt", "mess/Texts/c.txt"}
+	if strings.Join(keys, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected: %v got: %v", expected, keys)
+	}
+}
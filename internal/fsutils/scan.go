@@ -0,0 +1,199 @@
+package fsutils
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"sync"
+	"time"
+)
+
+const defaultScanWorkers = 16
+
+type ScanOptions struct {
+	Depth int
+	// FollowSymlinks descends into symlinked directories. Links pointing back
+	// to one of their own parents are reported with ErrSymlinkLoop.
+	FollowSymlinks bool
+	// Workers bounds how many directories are read at the same time.
+	Workers int
+}
+
+// Entry is a node found by Stream, with its path relative to the scanned
+// root in the same format as FileList.Walk.
+type Entry struct {
+	Path string
+	Node Node
+}
+
+// Scan lists root of fsys up to opts.Depth levels deep. Only an unreadable
+// root fails the scan, errors below it are kept on the nodes they occurred at.
+func Scan(fsys FS, root string, opts ScanOptions) (FileList, error) {
+	return Stream(context.Background(), fsys, root, opts, nil)
+}
+
+// Stream scans like Scan, reading directories concurrently, and sends every
+// node to entries as soon as it is found. Children of a directory may arrive
+// before the directory itself. entries is closed once the scan is done; a
+// nil channel only builds the returned list.
+func Stream(ctx context.Context, fsys FS, root string, opts ScanOptions, entries chan<- Entry) (FileList, error) {
+	if entries != nil {
+		defer close(entries)
+	}
+
+	info, err := fsys.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = defaultScanWorkers
+	}
+	s := scanner{
+		ctx:     ctx,
+		fsys:    fsys,
+		opts:    opts,
+		entries: entries,
+		sem:     make(chan struct{}, workers),
+	}
+
+	files, err := s.scanDir(root, "", opts.Depth, []fs.FileInfo{info})
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+type scanner struct {
+	ctx     context.Context
+	fsys    FS
+	opts    ScanOptions
+	entries chan<- Entry
+	// sem holds a slot for every directory read in its own goroutine.
+	sem chan struct{}
+}
+
+func (s *scanner) scanDir(root, rel string, depth int, parents []fs.FileInfo) ([]Node, error) {
+	if err := s.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	entries, err := s.fsys.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]Node, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// Gone or unreadable since the directory was read, it is
+			// reported along with what the listing told of it.
+			files = append(files, Node{Info: entryInfo{entry}, Kind: kindOf(entry.Type()), Err: err})
+			continue
+		}
+		files = append(files, Node{
+			Info: info,
+			Kind: kindOf(info.Mode()),
+		})
+	}
+
+	var wg sync.WaitGroup
+	for i := range files {
+		node := &files[i]
+		name := path.Join(root, node.Info.Name())
+		relPath := node.Info.Name()
+		if rel != "" {
+			relPath = rel + "/" + relPath
+		}
+
+		dirInfo := node.Info
+		if node.Kind == SymlinkNode && s.opts.FollowSymlinks {
+			if target, err := s.fsys.Stat(name); err == nil && target.IsDir() {
+				dirInfo = target
+			}
+		}
+
+		if depth == 0 || !dirInfo.IsDir() || node.Err != nil {
+			s.send(relPath, *node)
+			continue
+		}
+		if s.isAncestor(dirInfo, parents) {
+			node.Err = ErrSymlinkLoop
+			s.send(relPath, *node)
+			continue
+		}
+
+		chain := append(parents[:len(parents):len(parents)], dirInfo)
+		descend := func() {
+			node.Children, node.Err = s.scanDir(name, relPath, depth-1, chain)
+			s.send(relPath, *node)
+		}
+
+		// Read the directory in its own goroutine while a worker slot is
+		// free, otherwise right here, so the walk never waits on itself.
+		select {
+		case s.sem <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-s.sem }()
+				descend()
+			}()
+		default:
+			descend()
+		}
+	}
+	wg.Wait()
+
+	if err := s.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (s *scanner) send(relPath string, node Node) {
+	if s.entries == nil {
+		return
+	}
+	select {
+	case s.entries <- Entry{Path: displayName(relPath, node), Node: node}:
+	case <-s.ctx.Done():
+	}
+}
+
+// entryInfo is what a directory listing tells of an entry, for one whose
+// info could not be read.
+type entryInfo struct {
+	fs.DirEntry
+}
+
+func (e entryInfo) Size() int64        { return 0 }
+func (e entryInfo) Mode() fs.FileMode  { return e.Type() }
+func (e entryInfo) ModTime() time.Time { return time.Time{} }
+func (e entryInfo) Sys() any           { return nil }
+
+func kindOf(mode fs.FileMode) NodeKind {
+	switch {
+	case mode.IsDir():
+		return DirNode
+	case mode&fs.ModeSymlink != 0:
+		return SymlinkNode
+	case mode.IsRegular():
+		return FileNode
+	}
+	return SpecialNode
+}
+
+func (s *scanner) isAncestor(info fs.FileInfo, parents []fs.FileInfo) bool {
+	for _, p := range parents {
+		if s.fsys.SameFile(info, p) {
+			return true
+		}
+	}
+	return false
+}
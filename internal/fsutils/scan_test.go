@@ -0,0 +1,154 @@
+package fsutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func makeTree(tb testing.TB, dirs, files int) string {
+	tb.Helper()
+	root := tb.TempDir()
+	for d := 0; d < dirs; d++ {
+		dir := filepath.Join(root, fmt.Sprintf("dir_%d", d), "nested")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			tb.Fatal(err)
+		}
+		for f := 0; f < files; f++ {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file_%d.txt", f)), nil, 0644); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	return root
+}
+
+func TestStream(t *testing.T) {
+	root := makeTree(t, 8, 20)
+
+	entries := make(chan Entry)
+	var streamed []string
+	done := make(chan struct{})
+	go func() {
+		for e := range entries {
+			streamed = append(streamed, e.Path)
+		}
+		close(done)
+	}()
+
+	files, err := Stream(context.Background(), DirFS(root), ".", ScanOptions{Depth: -1, Workers: 4}, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	var walked []string
+	files.Walk(func(name string, _ Node) {
+		walked = append(walked, name)
+	})
+
+	if len(walked) != 8*22 {
+		t.Fatalf("expected: %d got: %d", 8*22, len(walked))
+	}
+	sort.Strings(streamed)
+	if fmt.Sprint(streamed) != fmt.Sprint(walked) {
+		t.Fatalf("streamed entries differ from list:\n%v\n%v", streamed, walked)
+	}
+
+	sequential, err := Scan(DirFS(root), ".", ScanOptions{Depth: -1, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sequential.String() != files.String() {
+		t.Fatalf("\nexpected:\n%s\ngot:\n%s\n", sequential, files)
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	root := makeTree(t, 4, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := Stream(ctx, DirFS(root), ".", ScanOptions{Depth: -1}, make(chan Entry))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected: %v got: %v", context.Canceled, err)
+	}
+}
+
+// vanishingFS lists gone as a file whose info can no longer be read.
+type vanishingFS struct {
+	*MemFS
+	gone string
+}
+
+type vanishedEntry struct {
+	fs.DirEntry
+}
+
+func (e vanishedEntry) Info() (fs.FileInfo, error) {
+	return nil, &fs.PathError{Op: "lstat", Path: e.Name(), Err: fs.ErrNotExist}
+}
+
+func (f vanishingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := f.MemFS.ReadDir(name)
+	for i, e := range entries {
+		if path.Join(name, e.Name()) == f.gone {
+			entries[i] = vanishedEntry{e}
+		}
+	}
+	return entries, err
+}
+
+func TestScanEntryInfoError(t *testing.T) {
+	fsys := vanishingFS{NewSampleFS(), "Dir/test_file_2.txt"}
+
+	files, err := ReadDir(fsys, ".", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := files.Errors()
+	if len(errs) != 1 || errs[0].Path != "Dir/test_file_2.txt" || !errors.Is(errs[0].Err, fs.ErrNotExist) {
+		t.Fatalf("expected an error for Dir/test_file_2.txt, got: %v", errs)
+	}
+}
+
+func BenchmarkScan(b *testing.B) {
+	root := makeTree(b, 50, 200)
+	for _, workers := range []int{1, defaultScanWorkers} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := Scan(DirFS(root), ".", ScanOptions{Depth: -1, Workers: workers}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFileListString(b *testing.B) {
+	files, err := Scan(DirFS(makeTree(b, 50, 200)), ".", ScanOptions{Depth: -1})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = files.String()
+	}
+}
+
+func BenchmarkFileListDetails(b *testing.B) {
+	files, err := Scan(DirFS(makeTree(b, 50, 200)), ".", ScanOptions{Depth: -1})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = files.Details()
+	}
+}
@@ -0,0 +1,211 @@
+package fsutils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type sftpFS struct {
+	client *sftp.Client
+	root   string
+}
+
+// SFTPFS returns the remote directory tree rooted at root.
+func SFTPFS(client *sftp.Client, root string) FS {
+	return sftpFS{client: client, root: root}
+}
+
+func (f sftpFS) path(name string) string {
+	return path.Join(f.root, name)
+}
+
+func (f sftpFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	return f.client.Open(f.path(name))
+}
+
+func (f sftpFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := f.client.ReadDir(f.path(name))
+	if err != nil {
+		return nil, err
+	}
+	dir, err := f.client.RealPath(f.path(name))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(sftpFileInfo{info, path.Join(dir, info.Name())}))
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries, nil
+}
+
+func (f sftpFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := f.client.Stat(f.path(name))
+	if err != nil {
+		return nil, err
+	}
+	realPath, err := f.client.RealPath(f.path(name))
+	if err != nil {
+		return nil, err
+	}
+	return sftpFileInfo{info, realPath}, nil
+}
+
+// sftpFileInfo is a FileInfo along with the path the server resolved it
+// to, symlinks followed.
+type sftpFileInfo struct {
+	fs.FileInfo
+	realPath string
+}
+
+func (f sftpFS) Lstat(name string) (fs.FileInfo, error) {
+	return f.client.Lstat(f.path(name))
+}
+
+// Rename uses the plain SFTP rename, which the protocol defines to fail if
+// newpath exists. Servers only report a generic failure then, so the
+// destination is checked afterwards to tell that case apart.
+func (f sftpFS) Rename(oldpath, newpath string) error {
+	err := f.client.Rename(f.path(oldpath), f.path(newpath))
+	if err == nil {
+		return nil
+	}
+	if _, serr := f.client.Lstat(f.path(newpath)); serr == nil {
+		return &fs.PathError{Op: "rename", Path: newpath, Err: fs.ErrExist}
+	}
+	return err
+}
+
+func (f sftpFS) MkdirAll(name string, _ fs.FileMode) error {
+	return f.client.MkdirAll(f.path(name))
+}
+
+func (f sftpFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	file, err := f.client.OpenFile(f.path(name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (f sftpFS) Remove(name string) error {
+	return f.client.Remove(f.path(name))
+}
+
+// SameFile compares the paths the server resolved both to, SFTP has no
+// inode numbers. Infos from Lstat have no resolved path and match nothing.
+func (f sftpFS) SameFile(fi1, fi2 fs.FileInfo) bool {
+	s1, ok1 := fi1.(sftpFileInfo)
+	s2, ok2 := fi2.(sftpFileInfo)
+	return ok1 && ok2 && s1.realPath == s2.realPath
+}
+
+// DialSFTP connects to an sftp://user@host[:port]/path URL. Authentication
+// uses the SSH agent, the default keys in ~/.ssh and a password given in the
+// URL, in that order. The host key has to be in ~/.ssh/known_hosts.
+func DialSFTP(u *url.URL) (FS, io.Closer, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read known hosts: %w", err)
+	}
+
+	user := u.User.Username()
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            sshAuthMethods(u, home),
+		HostKeyCallback: hostKeys,
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "22")
+	}
+	conn, err := ssh.Dial("tcp", host, config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to %s: %w", host, err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to start sftp: %w", err)
+	}
+
+	// "sftp://host/~/dir" is relative to the login directory.
+	root := u.Path
+	if root == "" || root == "/~" {
+		root = "."
+	} else if rel, ok := strings.CutPrefix(root, "/~/"); ok {
+		root = rel
+	}
+	return SFTPFS(client, root), closers{client, conn}, nil
+}
+
+func sshAuthMethods(u *url.URL, home string) []ssh.AuthMethod {
+	var methods []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+
+	var signers []ssh.Signer
+	for _, key := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		b, err := os.ReadFile(filepath.Join(home, ".ssh", key))
+		if err != nil {
+			continue
+		}
+		if signer, err := ssh.ParsePrivateKey(b); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	if password, ok := u.User.Password(); ok {
+		methods = append(methods, ssh.Password(password))
+	}
+	return methods
+}
+
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var errs []error
+	for _, closer := range c {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
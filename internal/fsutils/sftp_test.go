@@ -0,0 +1,155 @@
+package fsutils
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// testSFTP serves an in-memory tree over an in-process SFTP connection.
+func testSFTP(t *testing.T, names ...string) *sftp.Client {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+
+	handlers := sftp.InMemHandler()
+	handlers.FileList = realPathLister{handlers.FileList.(memLister)}
+	server := sftp.NewRequestServer(serverConn, handlers)
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	for _, name := range names {
+		if err := client.MkdirAll(path.Dir(name)); err != nil {
+			t.Fatal(err)
+		}
+		f, err := client.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(f, name)
+		f.Close()
+	}
+	return client
+}
+
+type memLister interface {
+	sftp.LstatFileLister
+	Readlink(name string) (string, error)
+}
+
+// realPathLister resolves symlinks in RealPath, as OpenSSH does, which the
+// in-memory handler leaves as they are.
+type realPathLister struct {
+	memLister
+}
+
+func (l realPathLister) RealPath(name string) (string, error) {
+	resolved := "/"
+	rest := strings.Split(path.Clean("/" + name)[1:], "/")
+	for follows := 0; len(rest) > 0; {
+		next := path.Join(resolved, rest[0])
+		rest = rest[1:]
+		target, err := l.Readlink(next)
+		if err != nil {
+			resolved = next
+			continue
+		}
+		if follows++; follows > 40 {
+			return "", errors.New("too many symlinks")
+		}
+		if !path.IsAbs(target) {
+			target = path.Join(resolved, target)
+		}
+		rest = append(strings.Split(path.Clean(target)[1:], "/"), rest...)
+		resolved = "/"
+	}
+	return resolved, nil
+}
+
+func TestSFTPFS(t *testing.T) {
+	client := testSFTP(t,
+		"/home/norbot/IMG 1.jpg",
+		"/home/norbot/notes.txt",
+		"/home/norbot/docs/old.pdf",
+	)
+	journal := NewJournal(t.TempDir(), "sftp://norbot@host/home/norbot")
+	base := SFTPFS(client, "/home/norbot")
+	fsys := WithJournal(base, journal)
+
+	files, err := ReadDir(fsys, ".", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedOutput := `IMG 1.jpg
+docs/
+notes.txt
+`
+	if output := files.String(); output != expectedOutput {
+		t.Fatalf("\nexpected:\n%s\ngot:\n%s\n", expectedOutput, output)
+	}
+
+	if err := CreateDir(fsys, "photos/2024/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveFile(fsys, "IMG 1.jpg", "photos/2024/img_1.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveFile(fsys, "notes.txt", "docs/old.pdf"); !errors.Is(err, ErrDestinationExists) {
+		t.Fatalf("expected: %v got: %v", ErrDestinationExists, err)
+	}
+
+	b, err := fs.ReadFile(fsys, "photos/2024/img_1.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "/home/norbot/IMG 1.jpg" {
+		t.Fatalf("unexpected content: %s", b)
+	}
+
+	journal.Close()
+	_, entries, err := ReadJournal(journal.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected: 3 entries got: %v", entries)
+	}
+	if err := Undo(base, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err = ReadDir(base, ".", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output := files.String(); output != expectedOutput {
+		t.Fatalf("\nexpected:\n%s\ngot:\n%s\n", expectedOutput, output)
+	}
+}
+
+func TestSFTPSymlinkLoop(t *testing.T) {
+	client := testSFTP(t, "/home/norbot/Dir/file.txt")
+	if err := client.Symlink(".", "/home/norbot/Dir/loop"); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := Scan(SFTPFS(client, "/home/norbot"), ".", ScanOptions{Depth: -1, FollowSymlinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := files.Errors()
+	if len(errs) != 1 || errs[0].Path != "Dir/loop" || !errors.Is(errs[0].Err, ErrSymlinkLoop) {
+		t.Fatalf("expected a loop at Dir/loop, got: %v", errs)
+	}
+}
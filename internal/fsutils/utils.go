@@ -1,37 +1,79 @@
 package fsutils
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"io/fs"
+	"path"
+	"time"
 )
 
-func MoveFile(currentFileName, resultFileName string) error {
-	if _, err := os.Stat(currentFileName); os.IsNotExist(err) {
+var ErrDestinationExists = errors.New("destination file already exists")
+
+// beforeRename is called right before the destination is claimed. Tests use
+// it to create the destination in between, simulating a concurrent writer.
+var beforeRename = func(oldpath, newpath string) {}
+
+func MoveFile(fsys FS, currentFileName, resultFileName string) error {
+	currentFileName, resultFileName = path.Clean(currentFileName), path.Clean(resultFileName)
+
+	if _, err := fsys.Lstat(currentFileName); errors.Is(err, fs.ErrNotExist) {
 		return fmt.Errorf("source file does not exist: %s", currentFileName)
 	}
 
-	if _, err := os.Stat(resultFileName); err == nil {
-		return fmt.Errorf("destination file already exists: %s", resultFileName)
-	} else if !os.IsNotExist(err) {
-		return fmt.Errorf("failed to check destination file: %w", err)
+	var err error
+	switch ComparePaths(currentFileName, resultFileName) {
+	case CaseOnly, NormalizationOnly:
+		err = renameViaTemp(fsys, currentFileName, resultFileName)
+	default:
+		beforeRename(currentFileName, resultFileName)
+		err = fsys.Rename(currentFileName, resultFileName)
 	}
-
-	err := os.Rename(currentFileName, resultFileName)
-	if err != nil {
+	if errors.Is(err, ErrNotJournaled) {
+		// The file did move.
+		return err
+	} else if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%w: %s", ErrDestinationExists, resultFileName)
+	} else if err != nil {
 		return fmt.Errorf("failed to move file: %w", err)
 	}
 
 	return nil
 }
 
-func CreateDir(dirName string) error {
-	if _, err := os.Stat(dirName); !os.IsNotExist(err) {
+// renameViaTemp renames a path to a spelling that differs only by case or
+// normalization. On case insensitive or normalizing filesystems both names
+// refer to the same file, so the new name would always look taken; going
+// through an unrelated temporary name works everywhere.
+func renameViaTemp(fsys FS, oldpath, newpath string) error {
+	tmp := path.Join(path.Dir(oldpath), fmt.Sprintf(".norbot-%d-%s", time.Now().UnixNano(), path.Base(oldpath)))
+	// Not journaling the first step is reported once the second is made.
+	journalErr := fsys.Rename(oldpath, tmp)
+	if journalErr != nil && !errors.Is(journalErr, ErrNotJournaled) {
+		return journalErr
+	}
+	beforeRename(tmp, newpath)
+	if err := fsys.Rename(tmp, newpath); errors.Is(err, ErrNotJournaled) {
+		return err
+	} else if err != nil {
+		if rerr := fsys.Rename(tmp, oldpath); rerr != nil {
+			return fmt.Errorf("%w (file left at %s)", err, tmp)
+		}
+		return err
+	}
+	return journalErr
+}
+
+func CreateDir(fsys FS, dirName string) error {
+	dirName = path.Clean(dirName)
+
+	if _, err := fsys.Stat(dirName); !errors.Is(err, fs.ErrNotExist) {
 		if err != nil {
 			return fmt.Errorf("failed to check directory: %w", err)
 		}
 	}
 
-	err := os.MkdirAll(dirName, 0755)
+	err := fsys.MkdirAll(dirName, 0755)
 	if err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
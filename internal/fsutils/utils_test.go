@@ -0,0 +1,254 @@
+package fsutils
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestMoveFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.txt")
+	dst := filepath.Join(dir, "b.txt")
+	writeFile(t, src, "a")
+
+	if err := MoveFile(DirFS(dir), "a.txt", "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Fatalf("expected source to be gone, got: %v", err)
+	}
+	if got := readFile(t, dst); got != "a" {
+		t.Fatalf("expected: a got: %s", got)
+	}
+}
+
+func TestMoveFileExistingDestination(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.txt")
+	dst := filepath.Join(dir, "b.txt")
+	writeFile(t, src, "a")
+	writeFile(t, dst, "b")
+
+	err := MoveFile(DirFS(dir), "a.txt", "b.txt")
+	if !errors.Is(err, ErrDestinationExists) {
+		t.Fatalf("expected: %v got: %v", ErrDestinationExists, err)
+	}
+	if got := readFile(t, dst); got != "b" {
+		t.Fatalf("destination overwritten, expected: b got: %s", got)
+	}
+}
+
+func TestMoveFileRace(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.txt")
+	dst := filepath.Join(dir, "b.txt")
+	writeFile(t, src, "a")
+
+	beforeRename = func(_, newpath string) {
+		writeFile(t, filepath.Join(dir, newpath), "racer")
+	}
+	t.Cleanup(func() { beforeRename = func(_, _ string) {} })
+
+	err := MoveFile(DirFS(dir), "a.txt", "b.txt")
+	if !errors.Is(err, ErrDestinationExists) {
+		t.Fatalf("expected: %v got: %v", ErrDestinationExists, err)
+	}
+	if got := readFile(t, dst); got != "racer" {
+		t.Fatalf("destination overwritten, expected: racer got: %s", got)
+	}
+	if got := readFile(t, src); got != "a" {
+		t.Fatalf("source lost, expected: a got: %s", got)
+	}
+}
+
+func TestLinkRename(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, src, dst string)
+		isDir bool
+		fails bool
+	}{
+		{
+			name:  "File",
+			setup: func(t *testing.T, src, _ string) { writeFile(t, src, "a") },
+		},
+		{
+			name: "File with existing destination",
+			setup: func(t *testing.T, src, dst string) {
+				writeFile(t, src, "a")
+				writeFile(t, dst, "racer")
+			},
+			fails: true,
+		},
+		{
+			name: "Directory",
+			setup: func(t *testing.T, src, _ string) {
+				os.Mkdir(src, 0755)
+				writeFile(t, filepath.Join(src, "f.txt"), "a")
+			},
+			isDir: true,
+		},
+		{
+			name: "Directory with existing destination",
+			setup: func(t *testing.T, src, dst string) {
+				os.Mkdir(src, 0755)
+				os.Mkdir(dst, 0755)
+				writeFile(t, filepath.Join(dst, "f.txt"), "racer")
+			},
+			isDir: true,
+			fails: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "src")
+			dst := filepath.Join(dir, "dst")
+			tt.setup(t, src, dst)
+
+			err := linkRename(src, dst)
+			if tt.fails {
+				if !errors.Is(err, os.ErrExist) {
+					t.Fatalf("expected: %v got: %v", os.ErrExist, err)
+				}
+				if _, err := os.Stat(src); err != nil {
+					t.Fatalf("source lost: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(src); !os.IsNotExist(err) {
+				t.Fatalf("expected source to be gone, got: %v", err)
+			}
+			info, err := os.Stat(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.IsDir() != tt.isDir {
+				t.Fatalf("expected dir: %v got: %v", tt.isDir, info.IsDir())
+			}
+		})
+	}
+}
+
+func TestComparePaths(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected PathDiff
+	}{
+		{"Photos/", "Photos/", IdenticalPaths},
+		{"caf\u00e9.txt", "cafe\u0301.txt", NormalizationOnly},
+		{"Photos/", "photos/", CaseOnly},
+		{"CAF\u00c9.txt", "cafe\u0301.txt", CaseOnly},
+		{"Photos/", "Videos/", DifferentPaths},
+	}
+	for _, tt := range tests {
+		if got := ComparePaths(tt.a, tt.b); got != tt.expected {
+			t.Errorf("ComparePaths(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestMoveFileCaseOnly(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "Readme.md")
+	writeFile(t, src, "a")
+
+	if err := MoveFile(DirFS(dir), "Readme.md", "README.md"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "README.md" {
+		t.Fatalf("expected only README.md, got: %v", entries)
+	}
+}
+
+func TestMoveFileCaseOnlyRace(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "Readme.md")
+	writeFile(t, src, "a")
+
+	beforeRename = func(_, newpath string) {
+		writeFile(t, filepath.Join(dir, newpath), "racer")
+	}
+	t.Cleanup(func() { beforeRename = func(_, _ string) {} })
+
+	if err := MoveFile(DirFS(dir), "Readme.md", "README.md"); !errors.Is(err, ErrDestinationExists) {
+		t.Fatalf("expected: %v got: %v", ErrDestinationExists, err)
+	}
+	if got := readFile(t, src); got != "a" {
+		t.Fatalf("source not restored, expected: a got: %s", got)
+	}
+}
+
+func TestMemFSMoveAndCreate(t *testing.T) {
+	fsys := testFS(t)
+
+	if err := CreateDir(fsys, "Texts/Old/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveFile(fsys, "Dir/", "Texts/Old/Dir/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveFile(fsys, "test_file.txt", "Texts/test_file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveFile(fsys, "test_file_2.txt", "Texts/test_file.txt"); !errors.Is(err, ErrDestinationExists) {
+		t.Fatalf("expected: %v got: %v", ErrDestinationExists, err)
+	}
+
+	files, err := ReadDir(fsys, ".", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedOutput := `Dir2/
+Dir2/test_file_1.txt
+Dir2/test_file_2.txt
+Texts/
+Texts/Old/
+Texts/Old/Dir/
+Texts/Old/Dir/test_file_1.txt
+Texts/Old/Dir/test_file_2.txt
+Texts/test_file.txt
+test_file_2.txt
+test_file_3.txt
+`
+	if output := files.String(); output != expectedOutput {
+		t.Fatalf("\nexpected:\n%s\ngot:\n%s\n", expectedOutput, output)
+	}
+
+	b, err := fs.ReadFile(fsys, "Texts/Old/Dir/test_file_1.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "Dir/test_file_1.txt" {
+		t.Fatalf("expected: Dir/test_file_1.txt got: %s", b)
+	}
+}
@@ -0,0 +1,125 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/atlomak/norbot/internal/fsutils"
+	"github.com/google/generative-ai-go/genai"
+)
+
+// candidateTemperatures vary the plans asked for after the first one, which
+// uses the model's defaults, so that they differ from each other.
+var candidateTemperatures = []float32{0.4, 1.2, 1.8, 0.8, 1.5}
+
+// Plan is one of the candidate answers to a prompt.
+type Plan struct {
+	Actions []Action
+	Score   Score
+	// history is the conversation leading to the plan, to go on from if
+	// it is chosen.
+	history []*genai.Content
+}
+
+// Score sums up a plan, so that candidates can be compared at a glance.
+type Score struct {
+	// Moves counts the files and directories going somewhere else.
+	Moves int
+	// Depth is the number of directories above the deepest destination.
+	Depth int
+	// NewDirs counts the directories the plan creates.
+	NewDirs int
+	// Violations counts actions breaking the rules the model was given:
+	// unknown files, paths outside the directory, keeps that move files and
+	// destinations taken twice.
+	Violations int
+}
+
+// generate sends text after history to the model, once per candidate, and
+// returns the plans that came back, the ones with fewer violations first.
+func (m GeminiModel) generate(ctx context.Context, history []*genai.Content, text string, files fsutils.FileList, received chan<- Received) ([]Plan, error) {
+	n := max(m.candidates, 1)
+	plans := make([]*Plan, n)
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := range n {
+		model := *m.model
+		if i > 0 {
+			model.SetTemperature(candidateTemperatures[(i-1)%len(candidateTemperatures)])
+		}
+		session := model.StartChat()
+		session.History = slices.Clone(history)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			actions, err := stream(ctx, session, text, i, received)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			plans[i] = &Plan{Actions: actions, Score: scorePlan(files, actions), history: session.History}
+		}()
+	}
+	wg.Wait()
+
+	var found []Plan
+	for _, plan := range plans {
+		if plan != nil {
+			found = append(found, *plan)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Score.Violations < found[j].Score.Violations
+	})
+	return found, nil
+}
+
+func scorePlan(files fsutils.FileList, actions []Action) Score {
+	listed := make(map[string]bool)
+	files.Walk(func(name string, _ fsutils.Node) {
+		listed[fsutils.NormKey(name)] = true
+	})
+
+	var score Score
+	results := make(map[string]bool)
+	newDirs := make(map[string]bool)
+	for _, a := range actions {
+		result := strings.TrimSuffix(a.Result, "/")
+		switch {
+		case !listed[fsutils.NormKey(a.Name)],
+			!fs.ValidPath(result) || result == ".",
+			a.Type == "keep" && a.Result != a.Name,
+			a.Type != "keep" && a.Type != "move",
+			results[fsutils.NormKey(a.Result)]:
+			score.Violations++
+			continue
+		}
+		results[fsutils.NormKey(a.Result)] = true
+
+		if a.Result != a.Name {
+			score.Moves++
+		}
+		score.Depth = max(score.Depth, strings.Count(result, "/"))
+		for dir := path.Dir(result); dir != "."; dir = path.Dir(dir) {
+			if !listed[fsutils.NormKey(dir+"/")] {
+				newDirs[dir] = true
+			}
+		}
+	}
+	score.NewDirs = len(newDirs)
+	return score
+}
@@ -0,0 +1,21 @@
+package llm
+
+import "testing"
+
+func TestScorePlan(t *testing.T) {
+	files := testFiles(t)
+	actions := []Action{
+		{Type: "move", Name: "Dir/", Result: "archive/2024/Dir/"},
+		{Type: "keep", Name: "Dir2/", Result: "Dir2/"},
+		{Type: "move", Name: "test_file.txt", Result: "Dir2/test_file.txt"},
+		{Type: "move", Name: "test_file_2.txt", Result: "Dir2/test_file.txt"},
+		{Type: "keep", Name: "test_file_3.txt", Result: "texts/test_file_3.txt"},
+		{Type: "move", Name: "missing.txt", Result: "texts/missing.txt"},
+		{Type: "move", Name: "Dir2/test_file_1.txt", Result: "../test_file_1.txt"},
+	}
+
+	expected := Score{Moves: 2, Depth: 2, NewDirs: 2, Violations: 4}
+	if got := scorePlan(files, actions); got != expected {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+}
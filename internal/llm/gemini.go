@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"sort"
+	"strings"
 
 	"github.com/atlomak/norbot/internal/fsutils"
 	"github.com/google/generative-ai-go/genai"
@@ -66,34 +67,105 @@ type Action struct {
 type GeminiModel struct {
 	model *genai.GenerativeModel
 	ctx   context.Context
+	// candidates is how many plans are asked for at once.
+	candidates int
 }
 
+// SetCandidates makes queries ask for n alternative plans.
+func (m *GeminiModel) SetCandidates(n int) {
+	m.candidates = n
+}
+
+// Query returns the best of the candidate plans for files.
 func (m GeminiModel) Query(files fsutils.FileList, prompt string) ([]Action, error) {
-	var resp *genai.GenerateContentResponse
-	var err error
-	if prompt != "" {
-		log.Printf("given prompt: %s", prompt)
-		query := fmt.Sprintf("additional prompt:\n%s\ndata:\n%s", prompt, files.Details())
-		resp, err = m.model.GenerateContent(m.ctx, genai.Text(query))
-	} else {
-		resp, err = m.model.GenerateContent(m.ctx, genai.Text(files.Details()))
+	plans, err := m.generate(m.ctx, nil, queryText(files, prompt), files, nil)
+	if err != nil {
+		return nil, err
 	}
+	return plans[0].Actions, nil
+}
+
+// Chat is a conversation about one directory, in which follow-up prompts
+// revise the plan instead of starting over.
+type Chat struct {
+	model   GeminiModel
+	files   fsutils.FileList
+	history []*genai.Content
+}
+
+func (m GeminiModel) StartChat() *Chat {
+	return &Chat{model: m}
+}
+
+// Query asks for the first plans of the conversation, best first. The
+// conversation goes on from the first one unless another is chosen.
+// Actions are passed on to received, if not nil, as they stream in.
+func (c *Chat) Query(ctx context.Context, files fsutils.FileList, prompt string, received chan<- Received) ([]Plan, error) {
+	c.files = files
+	return c.send(ctx, queryText(files, prompt), received)
+}
+
+// Revise asks for plan, the current state of the chosen plan, to be changed
+// as prompt says. Rejected holds suggestions the user turned down, the
+// model is told not to make them again.
+func (c *Chat) Revise(ctx context.Context, prompt string, plan, rejected []Action, received chan<- Received) ([]Plan, error) {
+	log.Printf("given follow-up prompt: %s", prompt)
+	return c.send(ctx, reviseText(prompt, plan, rejected), received)
+}
+
+// Choose continues the conversation from plan.
+func (c *Chat) Choose(plan Plan) {
+	c.history = plan.history
+}
+
+func (c *Chat) send(ctx context.Context, text string, received chan<- Received) ([]Plan, error) {
+	plans, err := c.model.generate(ctx, c.history, text, c.files, received)
 	if err != nil {
 		return nil, err
 	}
+	c.Choose(plans[0])
+	return plans, nil
+}
 
-	actions := make([]Action, 0, len(files))
-	for _, part := range resp.Candidates[0].Content.Parts {
-		if txt, ok := part.(genai.Text); ok {
-			var output []map[string]string
-			if err := json.Unmarshal([]byte(txt), &output); err != nil {
-				return nil, err
-			}
-			for _, action := range output {
-				actions = append(actions, Action{Name: action["name"], Type: action["action"], Result: action["result"]})
-			}
+func queryText(files fsutils.FileList, prompt string) string {
+	if prompt == "" {
+		return files.Details()
+	}
+	log.Printf("given prompt: %s", prompt)
+	return fmt.Sprintf("additional prompt:\n%s\ndata:\n%s", prompt, files.Details())
+}
+
+// reviseText describes the plan as the user left it, in the format the
+// model answers with, followed by the rejections and the new instruction.
+func reviseText(prompt string, plan, rejected []Action) string {
+	var b strings.Builder
+	b.WriteString("The plan after the user reviewed it:\n")
+	for _, a := range plan {
+		fmt.Fprintf(&b, "{ \"action\": %q, \"name\": %q, \"result\": %q }\n", a.Type, a.Name, a.Result)
+	}
+	if len(rejected) > 0 {
+		b.WriteString("\nThe user rejected these suggestions, keep the files where they are:\n")
+		for _, a := range rejected {
+			fmt.Fprintf(&b, "- %s -> %s\n", a.Name, a.Result)
 		}
 	}
+	fmt.Fprintf(&b, "\nRevise the plan as follows and return all of it, every file included:\n%s", prompt)
+	return b.String()
+}
+
+// parseText reads the actions from the JSON array the model answers with.
+func parseText(text string) ([]Action, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("no plan in the response")
+	}
+	var output []map[string]string
+	if err := json.Unmarshal([]byte(text), &output); err != nil {
+		return nil, err
+	}
+	actions := make([]Action, 0, len(output))
+	for _, action := range output {
+		actions = append(actions, Action{Name: action["name"], Type: action["action"], Result: action["result"]})
+	}
 	sortActions(actions)
 	return actions, nil
 }
@@ -146,7 +218,8 @@ func InitGeminiModel(client *genai.Client, ctx context.Context) *GeminiModel {
 	}
 	model.SystemInstruction = genai.NewUserContent(genai.Text(query))
 	return &GeminiModel{
-		model: model,
-		ctx:   ctx,
+		model:      model,
+		ctx:        ctx,
+		candidates: 1,
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/atlomak/norbot/internal/fsutils"
@@ -11,6 +12,15 @@ import (
 	"google.golang.org/api/option"
 )
 
+func testFiles(t *testing.T) fsutils.FileList {
+	t.Helper()
+	files, err := fsutils.ReadDir(fsutils.NewSampleFS(), ".", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
 func generateOutput(files fsutils.FileList) []Action {
 	ctx := context.Background()
 	client, err := genai.NewClient(ctx, option.WithAPIKey(os.Getenv("GEMINI_API_KEY")))
@@ -32,10 +42,7 @@ func TestOutputSize(t *testing.T) {
 		t.SkipNow()
 	}
 
-	files, err := fsutils.ReadDir("../test_dir", 0)
-	if err != nil {
-		t.Fatal(err)
-	}
+	files := testFiles(t)
 
 	output := generateOutput(files)
 
@@ -51,10 +58,7 @@ func TestOutputFileNames(t *testing.T) {
 		t.SkipNow()
 	}
 
-	files, err := fsutils.ReadDir("../test_dir", 0)
-	if err != nil {
-		t.Fatal(err)
-	}
+	files := testFiles(t)
 
 	output := generateOutput(files)
 
@@ -83,3 +87,46 @@ func TestOutputFileNames(t *testing.T) {
 	}
 
 }
+
+func TestReviseText(t *testing.T) {
+	plan := []Action{
+		{Type: "move", Name: "IMG 1.jpg", Result: "photos/img_1.jpg"},
+		{Type: "keep", Name: "notes.txt", Result: "notes.txt"},
+	}
+	rejected := []Action{{Type: "move", Name: "notes.txt", Result: "texts/notes.txt"}}
+
+	expected := `The plan after the user reviewed it:
+{ "action": "move", "name": "IMG 1.jpg", "result": "photos/img_1.jpg" }
+{ "action": "keep", "name": "notes.txt", "result": "notes.txt" }
+
+The user rejected these suggestions, keep the files where they are:
+- notes.txt -> texts/notes.txt
+
+Revise the plan as follows and return all of it, every file included:
+keep screenshots at top level`
+	if got := reviseText("keep screenshots at top level", plan, rejected); got != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestActionParser(t *testing.T) {
+	answer := `[{"action": "move", "name": "a \"b\".txt", "result": "texts/a {b}.txt"},
+ {"action": "keep", "name": "notes.txt", "result": "notes.txt"}]`
+
+	var p actionParser
+	var got []Action
+	// Chunks split anywhere, even inside strings and escapes.
+	for i := 0; i < len(answer); i += 7 {
+		got = append(got, p.feed(answer[i:min(i+7, len(answer))])...)
+	}
+	expected := []Action{
+		{Type: "move", Name: `a "b".txt`, Result: "texts/a {b}.txt"},
+		{Type: "keep", Name: "notes.txt", Result: "notes.txt"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	if p.text() != answer {
+		t.Fatalf("expected the whole answer to be kept, got %q", p.text())
+	}
+}
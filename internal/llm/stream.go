@@ -0,0 +1,111 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+)
+
+// Received is an action of a candidate plan, sent as soon as the model
+// wrote it, before the plan is complete.
+type Received struct {
+	Candidate int
+	Action    Action
+}
+
+// actionParser picks the actions out of a JSON array of them as it comes
+// in, chunk by chunk.
+type actionParser struct {
+	buf      strings.Builder
+	pos      int
+	depth    int
+	start    int
+	inString bool
+	escaped  bool
+}
+
+// feed adds chunk to the text so far and returns the actions it completed.
+func (p *actionParser) feed(chunk string) []Action {
+	p.buf.WriteString(chunk)
+	text := p.buf.String()
+
+	var actions []Action
+	for ; p.pos < len(text); p.pos++ {
+		c := text[p.pos]
+		if p.inString {
+			switch {
+			case p.escaped:
+				p.escaped = false
+			case c == '\\':
+				p.escaped = true
+			case c == '"':
+				p.inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			p.inString = true
+		case '[', '{':
+			p.depth++
+			if c == '{' && p.depth == 2 {
+				p.start = p.pos
+			}
+		case ']', '}':
+			if c == '}' && p.depth == 2 {
+				var output map[string]string
+				if err := json.Unmarshal([]byte(text[p.start:p.pos+1]), &output); err == nil {
+					actions = append(actions, Action{Name: output["name"], Type: output["action"], Result: output["result"]})
+				}
+			}
+			p.depth--
+		}
+	}
+	return actions
+}
+
+// text returns everything fed so far.
+func (p *actionParser) text() string {
+	return p.buf.String()
+}
+
+// stream sends text in session and passes the actions on to received as
+// they come, tagged with candidate. The complete answer is parsed again at
+// the end, so that a plan never misses what the stream did not show.
+func stream(ctx context.Context, session *genai.ChatSession, text string, candidate int, received chan<- Received) ([]Action, error) {
+	iter := session.SendMessageStream(ctx, genai.Text(text))
+	var parser actionParser
+	for {
+		resp, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+			continue
+		}
+		for _, part := range resp.Candidates[0].Content.Parts {
+			txt, ok := part.(genai.Text)
+			if !ok {
+				continue
+			}
+			for _, action := range parser.feed(string(txt)) {
+				if received == nil {
+					continue
+				}
+				select {
+				case received <- Received{Candidate: candidate, Action: action}:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+		}
+	}
+	return parseText(parser.text())
+}
@@ -0,0 +1,45 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/atlomak/norbot/internal/llm"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// showCandidate swaps the plan for candidate i, the conversation goes on
+// from it. Review work on the plan shown before is dropped.
+func (m *model) showCandidate(i int) tea.Cmd {
+	m.candidate = i
+	plan := m.candidates[i]
+	if m.chat != nil {
+		m.chat.Choose(plan)
+	}
+	if m.revision > 0 {
+		return m.applyRevision(plan.Actions)
+	}
+	return m.updateResults(plan.Actions)
+}
+
+// candidatesView compares the candidate plans in a line, marking the one
+// shown.
+func (m model) candidatesView() string {
+	parts := make([]string, 0, len(m.candidates))
+	for i, plan := range m.candidates {
+		mark := " "
+		if i == m.candidate {
+			mark = icons.chosen
+		}
+		parts = append(parts, fmt.Sprintf("%s%d: %s", mark, i+1, scoreString(plan.Score)))
+	}
+	return fmt.Sprintf("Plans ([ and ] switch): %s", strings.Join(parts, "  "))
+}
+
+func scoreString(s llm.Score) string {
+	str := fmt.Sprintf("%d moves, %d new dirs, depth %d", s.Moves, s.NewDirs, s.Depth)
+	if s.Violations > 0 {
+		str += fmt.Sprintf(", %d invalid", s.Violations)
+	}
+	return str
+}
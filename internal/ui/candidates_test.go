@@ -0,0 +1,39 @@
+package ui
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/atlomak/norbot/internal/llm"
+)
+
+func TestShowCandidate(t *testing.T) {
+	m, _ := testModel(t, "a.jpg", "notes.txt")
+	m.candidates = []llm.Plan{
+		{Actions: []llm.Action{
+			{Type: "move", Name: "a.jpg", Result: "photos/a.jpg"},
+			{Type: "keep", Name: "notes.txt", Result: "notes.txt"},
+		}, Score: llm.Score{Moves: 1, Depth: 1, NewDirs: 1}},
+		{Actions: []llm.Action{
+			{Type: "move", Name: "a.jpg", Result: "media/images/a.jpg"},
+			{Type: "move", Name: "notes.txt", Result: "texts/notes.txt"},
+		}, Score: llm.Score{Moves: 2, Depth: 2, NewDirs: 3}},
+	}
+	m.updateResults(m.candidates[0].Actions)
+
+	m.showCandidate(1)
+	expected := []string{
+		"create  -> media/",
+		"create  -> media/images/",
+		"create  -> texts/",
+		"move a.jpg -> media/images/a.jpg",
+		"move notes.txt -> texts/notes.txt",
+	}
+	if got := planString(m.items); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("\nexpected: %q\ngot:      %q", expected, got)
+	}
+	if view := m.candidatesView(); !strings.Contains(view, " 1: 1 moves") || !strings.Contains(view, "▸2: 2 moves, 3 new dirs, depth 2") {
+		t.Fatalf("unexpected comparison: %s", view)
+	}
+}
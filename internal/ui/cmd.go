@@ -1,13 +1,17 @@
 package ui
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log"
+	"slices"
 	"sort"
 	"time"
 
 	"github.com/atlomak/norbot/internal/fsutils"
 	"github.com/atlomak/norbot/internal/llm"
-	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
@@ -16,54 +20,291 @@ type readDirMsg struct {
 	err   error
 }
 
+// queryResultMsg carries the candidate plans, best first, revised tells
+// revisions of the last plan from new plans.
 type queryResultMsg struct {
-	actions []llm.Action
+	plans   []llm.Plan
+	revised bool
+	stream  *planStream
 	err     error
 }
 
+// streamProgressMsg carries the actions received since the last one.
+type streamProgressMsg struct {
+	received []llm.Received
+	stream   *planStream
+}
+
+// applyChangesMsg reports the changes applied, with moves mapping the moved
+// files and directories to their new paths and report telling what became
+// of each change. With links set it reports the link edits instead. err
+// joins the errors of the changes that failed.
 type applyChangesMsg struct {
-	err error
+	moves  map[string]string
+	report *applyReport
+	links  bool
+	err    error
+}
+
+// linkEditsMsg carries the edits fixing the links broken by moves.
+type linkEditsMsg struct {
+	edits []fsutils.LinkEdit
+	moves map[string]string
+	err   error
+}
+
+type scanProgressMsg struct {
+	found int
+	scan  *dirScan
 }
 
-type tickMsg time.Time
+const scanProgressInterval = 100 * time.Millisecond
+
+type dirScan struct {
+	entries chan fsutils.Entry
+	result  chan readDirMsg
+}
 
-func readDir(root string, depth int) tea.Cmd {
+func readDir(fsys fsutils.FS, root string, opts fsutils.ScanOptions) tea.Cmd {
 	return func() tea.Msg {
-		files, err := fsutils.ReadDir(root, depth)
-		if err != nil {
-			return readDirMsg{
-				err: err,
+		scan := &dirScan{
+			entries: make(chan fsutils.Entry, 1024),
+			result:  make(chan readDirMsg, 1),
+		}
+		go func() {
+			files, err := fsutils.Stream(context.Background(), fsys, root, opts, scan.entries)
+			if err != nil {
+				scan.result <- readDirMsg{err: err}
+				return
+			}
+			scan.result <- readDirMsg{files: files, err: nil}
+		}()
+		return scan.wait()
+	}
+}
+
+// wait counts entries for a short while before reporting them, so that huge
+// trees do not flood the UI with a message per file.
+func (s *dirScan) wait() tea.Msg {
+	found := 0
+	deadline := time.After(scanProgressInterval)
+	for {
+		select {
+		case _, ok := <-s.entries:
+			if !ok {
+				return <-s.result
 			}
+			found++
+		case <-deadline:
+			return scanProgressMsg{found: found, scan: s}
 		}
-		return readDirMsg{files: files, err: nil}
 	}
 }
 
-func (m model) queryResult(files fsutils.FileList, prompt string) tea.Cmd {
-	return func() tea.Msg {
-		actions, err := m.llm.Query(files, prompt)
-		if err != nil {
-			return queryResultMsg{err: err}
+// planStream is a query running in the background. The conversation it
+// belongs to replaces the current one once the query succeeds.
+type planStream struct {
+	chat     *llm.Chat
+	revised  bool
+	received chan llm.Received
+	result   chan queryResultMsg
+	cancel   context.CancelFunc
+	// retry asks the same again, in a new stream.
+	retry func(m *model) tea.Cmd
+}
+
+// startStream runs query, a question to chat, in the background.
+func (m *model) startStream(chat *llm.Chat, revised bool, query func(ctx context.Context, received chan<- llm.Received) ([]llm.Plan, error)) tea.Cmd {
+	if m.stream != nil {
+		// A query still running would otherwise go on in the background.
+		m.stream.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &planStream{
+		chat:     chat,
+		revised:  revised,
+		received: make(chan llm.Received, 1024),
+		result:   make(chan queryResultMsg, 1),
+		cancel:   cancel,
+	}
+	m.stream = s
+	m.streamed = make(map[int][]llm.Action)
+	if m.plan != nil && m.reviewed == nil {
+		// Kept over a retry, by then the items are what was streamed.
+		m.reviewed = slices.Clone(m.items)
+	}
+
+	start := func() tea.Msg {
+		go func() {
+			defer cancel()
+			plans, err := query(ctx, s.received)
+			close(s.received)
+			s.result <- queryResultMsg{plans: plans, revised: revised, stream: s, err: err}
+		}()
+		return s.wait()
+	}
+	return tea.Sequence(m.progress.SetPercent(0), start)
+}
+
+// wait collects streamed actions for a short while before reporting them,
+// the same way dirScan.wait counts entries.
+func (s *planStream) wait() tea.Msg {
+	var received []llm.Received
+	deadline := time.After(scanProgressInterval)
+	for {
+		select {
+		case r, ok := <-s.received:
+			if !ok {
+				if len(received) > 0 {
+					return streamProgressMsg{received: received, stream: s}
+				}
+				return <-s.result
+			}
+			received = append(received, r)
+		case <-deadline:
+			return streamProgressMsg{received: received, stream: s}
 		}
-		return queryResultMsg{actions: actions, err: nil}
 	}
 }
 
+// startQuery starts a new conversation about files. The plan so far stays
+// until the new one arrives.
 func (m *model) startQuery(files fsutils.FileList, prompt string) tea.Cmd {
-	progressMsg := m.progress.SetPercent(0)
-	tickCmd := tickCmd()
-	queryCmd := m.queryResult(files, prompt)
-	return tea.Sequence(progressMsg, tickCmd, queryCmd)
+	chat := m.llm.StartChat()
+	cmd := m.startStream(chat, false, func(ctx context.Context, received chan<- llm.Received) ([]llm.Plan, error) {
+		return chat.Query(ctx, files, prompt, received)
+	})
+	m.stream.retry = func(m *model) tea.Cmd { return m.startQuery(files, prompt) }
+	return cmd
+}
+
+// receive moves the progress bar by the actions received, compared to the
+// files asked about, and shows a new plan as far as it came.
+func (m *model) receive(received []llm.Received) tea.Cmd {
+	for _, r := range received {
+		m.streamed[r.Candidate] = append(m.streamed[r.Candidate], r.Action)
+	}
+	furthest := m.furthest()
+	progressCmd := m.progress.SetPercent(min(float64(len(furthest))/float64(max(m.expected(), 1)), 0.95))
+	if m.stream.revised || len(received) == 0 {
+		// A revision leaves the plan under review in place until it is done.
+		return progressCmd
+	}
+	m.actions = generateActionMapWithDirs(matchNames(slices.Clone(furthest), m.files))
+	m.items = m.resultsToItems(m.actions)
+	return tea.Batch(progressCmd, m.refreshTree())
+}
+
+// furthest returns the actions of the candidate that got furthest.
+func (m model) furthest() []llm.Action {
+	var furthest []llm.Action
+	for _, actions := range m.streamed {
+		if len(actions) > len(furthest) {
+			furthest = actions
+		}
+	}
+	return furthest
+}
+
+// expected returns how many actions a plan should have, one per file
+// Norbot asked about.
+func (m model) expected() int {
+	n := 0
+	m.files.Walk(func(string, fsutils.Node) { n++ })
+	return n
+}
+
+// cancelQuery aborts the running query and goes back to the plan there was
+// before, if any.
+func (m *model) cancelQuery() tea.Cmd {
+	m.stream.cancel()
+	m.stream = nil
+	return m.restorePlan()
+}
+
+// restorePlan shows the plan there was before a query, if any, in place of
+// what the query streamed.
+func (m *model) restorePlan() tea.Cmd {
+	if m.plan == nil {
+		m.status = Started
+		m.actions = nil
+		m.items = filesToItems(m.files)
+		return m.refreshTree()
+	}
+	m.status = Ready
+	if m.reviewed != nil {
+		m.items, m.reviewed = m.reviewed, nil
+	}
+	return m.replan()
+}
+
+func (m *model) toggleItem() tea.Cmd {
+	row, ok := m.list.SelectedItem().(treeRow)
+	if !ok || row.node.item < 0 {
+		return nil
+	}
+	m.items[row.node.item] = m.toggleItemAction(m.items[row.node.item])
+	if row.item.name != "" {
+		m.syncCreates()
+	}
+	return m.refreshTree()
+}
+
+// refreshTree shows the proposed layout of the plan, keeping the selected
+// item selected wherever it ends up.
+func (m *model) refreshTree() tea.Cmd {
+	selected := -1
+	if row, ok := m.list.SelectedItem().(treeRow); ok {
+		selected = row.node.item
+	}
+
+	rows := buildTree(m.items, m.placeFiltered()).rows(m.items, m.collapsed)
+	cmd := m.list.SetItems(rows)
+	for i, row := range rows {
+		if selected >= 0 && row.(treeRow).node.item == selected {
+			m.list.Select(i)
+		}
+	}
+	m.markRows()
+	return cmd
+}
+
+// collapse folds the selected directory, or moves to the directory
+// containing the selection.
+func (m *model) collapse() tea.Cmd {
+	row, ok := m.list.SelectedItem().(treeRow)
+	if !ok {
+		return nil
+	}
+	if row.node.isDir() && !row.collapsed {
+		m.collapsed[row.node.path] = true
+		return m.refreshTree()
+	}
+	parent := parentOf(row.node.path)
+	for i, r := range m.list.Items() {
+		if r.(treeRow).node.path == parent {
+			m.list.Select(i)
+		}
+	}
+	return nil
+}
+
+func (m *model) expand() tea.Cmd {
+	row, ok := m.list.SelectedItem().(treeRow)
+	if !ok || !row.collapsed {
+		return nil
+	}
+	delete(m.collapsed, row.node.path)
+	return m.refreshTree()
 }
 
-func (m *model) toggleItem() tea.Msg {
-	selected := m.list.SelectedItem().(item)
-	toggled := m.toggleItemAction(selected)
-	idx := m.list.Index()
-	return m.list.SetItem(idx, toggled)
+func (m *model) toggleLinkItem() tea.Msg {
+	selected := m.list.SelectedItem().(linkItem)
+	selected.rejected = !selected.rejected
+	return m.list.SetItem(m.list.Index(), selected)
 }
 
-func (m model) toggleItemAction(it item) list.Item {
+func (m model) toggleItemAction(it item) item {
 	log.Printf("toggleItem: %v\n", it)
 	if it.rejected {
 		if it.name == "" {
@@ -74,6 +315,7 @@ func (m model) toggleItemAction(it item) list.Item {
 		if action, exists := m.actions[it.name]; exists {
 			it.action = action.Type
 			it.result = action.Result
+			it.conflict = m.resolved[it.name]
 			it.rejected = false
 		}
 		return it
@@ -84,6 +326,7 @@ func (m model) toggleItemAction(it item) list.Item {
 	if it.name != "" {
 		it.result = it.name
 		it.action = "keep"
+		it.conflict = ""
 	} else {
 		it.action = "!create"
 	}
@@ -93,37 +336,62 @@ func (m model) toggleItemAction(it item) list.Item {
 
 func (m *model) setItems(files fsutils.FileList) tea.Cmd {
 	m.files = files
-	items := filesToItems(m.files)
-	return m.list.SetItems(items)
+	m.warnings = scanWarnings(files)
+	m.previews = make(map[string]previewMsg)
+	m.items = filesToItems(m.files)
+	// A plan is about the files it was made for, follow-ups start over.
+	m.plan, m.chat, m.candidates = nil, nil, nil
+	m.revision, m.changes = 0, nil
+	return m.refreshTree()
 }
 
 func (m *model) updateResults(actions []llm.Action) tea.Cmd {
-	m.maxDepth = maxDepth(actions)
-	m.actions = generateActionMapWithDirs(actions)
-	return m.list.SetItems(m.resultsToItems(m.actions))
+	actions = matchNames(actions, m.files)
+	m.plan, m.resolved = newConflictResolver(m.fsys, m.options.Conflicts).resolve(actions)
+	m.items = nil
+	m.changes = nil
+	return m.replan()
 }
 
-func (m model) resultsToItems(actions map[string]llm.Action) []list.Item {
+func (m model) resultsToItems(actions map[string]llm.Action) []item {
 	items := filesToItems(m.files)
 	remaining := make(map[string]llm.Action)
 	for k, v := range actions {
 		remaining[k] = v
 	}
 
-	for i, listItem := range items {
-		fileItem := listItem.(item)
+	for i, fileItem := range items {
+		if fileItem.immovable {
+			fileItem.action = "keep"
+			fileItem.result = fileItem.name
+			items[i] = fileItem
+			delete(remaining, fileItem.name)
+			continue
+		}
 		if action, exists := remaining[fileItem.name]; exists {
 			fileItem.action = action.Type
 			fileItem.result = action.Result
+			fileItem.conflict = m.resolved[fileItem.name]
 			items[i] = fileItem
 			delete(remaining, fileItem.name)
 		} else {
 			fileItem.action = "keep"
 			fileItem.result = fileItem.name
+			items[i] = fileItem
 		}
 	}
 
 	for _, remainingAction := range remaining {
+		if _, merged := m.resolved[remainingAction.Name]; merged && remainingAction.Type == "move" {
+			// Children of a merged directory are not part of the listing.
+			items = append(items, item{
+				name:     remainingAction.Name,
+				action:   remainingAction.Type,
+				result:   remainingAction.Result,
+				conflict: m.resolved[remainingAction.Name],
+			})
+			continue
+		}
 		if remainingAction.Type != "create" {
 			continue
 		}
@@ -138,33 +406,95 @@ func (m model) resultsToItems(actions map[string]llm.Action) []list.Item {
 	return items
 }
 
+// applyChanges goes through the plan sorted by result, so that directories
+// are created before anything is moved into them, and a move into a place
+// another move vacates after that one. A change that fails is reported and
+// the rest are still made.
 func (m model) applyChanges() tea.Msg {
-	var err error
-	for _, v := range m.list.Items() {
-		i := v.(item)
+	items := slices.Clone(m.items)
+	vacating := make(map[string]item)
+	for _, i := range items {
+		if i.action == "move" {
+			vacating[cleanPath(i.name)] = i
+		}
+	}
+	after := func(i item) int {
+		n := 0
+		for next, ok := vacating[cleanPath(i.result)]; ok && n < len(items); next, ok = vacating[cleanPath(next.result)] {
+			n++
+		}
+		return n
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if a, b := after(items[i]), after(items[j]); a != b {
+			return a < b
+		}
+		return items[i].result < items[j].result
+	})
+
+	report := &applyReport{Started: time.Now(), Journal: m.options.Journal}
+	var errs []error
+	moves := make(map[string]string)
+	for _, i := range items {
 		switch i.action {
 		case "create":
-			err = fsutils.CreateDir(i.result)
+			if err := fsutils.CreateDir(m.fsys, i.result); err != nil {
+				report.add(i, outcomeFailed, err)
+				errs = append(errs, fmt.Errorf("create %s: %w", i.result, err))
+				continue
+			}
+			report.add(i, outcomeCreated, nil)
 		case "move":
-			err = fsutils.MoveFile(i.name, i.result)
-		case "keep":
+			if m.moved(i) {
+				// Done before a failure, applying again goes on from there,
+				// its links still to be updated.
+				moves[i.name] = i.result
+				report.add(i, outcomeMoved, nil)
+				continue
+			}
+			if err := fsutils.MoveFile(m.fsys, i.name, i.result); err != nil {
+				report.add(i, outcomeFailed, err)
+				errs = append(errs, fmt.Errorf("move %s: %w", i.name, err))
+				continue
+			}
+			moves[i.name] = i.result
+			report.add(i, outcomeMoved, nil)
+		default:
+			report.skip(i)
 		}
 	}
-	return applyChangesMsg{err: err}
+	report.Elapsed = time.Since(report.Started)
+	return applyChangesMsg{moves: moves, report: report, err: errors.Join(errs...)}
 }
 
-func (m model) sortItems() tea.Msg {
-	items := m.list.Items()
-	sort.Slice(items, func(i, j int) bool {
-		itemA := items[i].(item)
-		itemB := items[j].(item)
-		return itemA.result <= itemB.result
-	})
-	return m.list.SetItems(items)
+// moved reports whether the move of i was already made.
+func (m model) moved(i item) bool {
+	if _, err := m.fsys.Lstat(i.name); !errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	_, err := m.fsys.Lstat(i.result)
+	return err == nil
 }
 
-func tickCmd() tea.Cmd {
-	return tea.Tick(time.Millisecond*200, func(t time.Time) tea.Msg {
-		return tickMsg(t)
-	})
+func findLinkEdits(fsys fsutils.FS, moves map[string]string) tea.Cmd {
+	return func() tea.Msg {
+		edits, err := fsutils.FindLinkEdits(fsys, moves)
+		return linkEditsMsg{edits: edits, moves: moves, err: err}
+	}
+}
+
+// applyLinkEdits writes the edits that were not rejected during review.
+func (m model) applyLinkEdits() tea.Msg {
+	var edits []fsutils.LinkEdit
+	for _, v := range m.list.Items() {
+		if i := v.(linkItem); !i.rejected {
+			edits = append(edits, i.edit)
+		}
+	}
+	return applyChangesMsg{links: true, err: fsutils.ApplyLinkEdits(m.fsys, edits)}
+}
+
+func (m *model) rescan() tea.Cmd {
+	m.scanning, m.scanned = true, 0
+	return readDir(m.fsys, ".", m.scanOptions(m.maxDepth))
 }
@@ -0,0 +1,117 @@
+package ui
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/atlomak/norbot/internal/fsutils"
+	"github.com/atlomak/norbot/internal/llm"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func testModel(t *testing.T, names ...string) (model, *fsutils.MemFS) {
+	t.Helper()
+	fsys := fsutils.NewMemFS()
+	for _, name := range names {
+		if err := fsys.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := InitModel(nil, fsys, Options{})
+	files, err := fsutils.ReadDir(fsys, ".", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.setItems(files)
+	return m, fsys
+}
+
+func TestPlanAndApply(t *testing.T) {
+	m, fsys := testModel(t, "IMG 1.jpg", "notes.txt", "report.pdf", "docs/old.pdf")
+
+	m.updateResults([]llm.Action{
+		{Type: "move", Name: "IMG 1.jpg", Result: "photos/2024/img_1.jpg"},
+		{Type: "keep", Name: "notes.txt", Result: "notes.txt"},
+		{Type: "move", Name: "report.pdf", Result: "docs/report.pdf"},
+		{Type: "keep", Name: "docs/", Result: "docs/"},
+	})
+
+	msg := m.applyChanges().(applyChangesMsg)
+	if msg.err != nil {
+		t.Fatal(msg.err)
+	}
+
+	files, err := fsutils.ReadDir(fsys, ".", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedOutput := `docs/
+docs/old.pdf
+docs/report.pdf
+notes.txt
+photos/
+photos/2024/
+photos/2024/img_1.jpg
+`
+	if output := files.String(); output != expectedOutput {
+		t.Fatalf("\nexpected:\n%s\ngot:\n%s\n", expectedOutput, output)
+	}
+}
+
+func TestReviewLinkEdits(t *testing.T) {
+	m, fsys := testModel(t, "notes.md", "report.pdf", "img.png")
+	fsys.WriteFile("notes.md", []byte("[report](report.pdf) ![img](img.png)\n"), 0644)
+	m.options.UpdateLinks = true
+
+	m.updateResults([]llm.Action{
+		{Type: "keep", Name: "notes.md", Result: "notes.md"},
+		{Type: "move", Name: "report.pdf", Result: "docs/report.pdf"},
+		{Type: "move", Name: "img.png", Result: "docs/img.png"},
+	})
+
+	updated, cmd := m.Update(m.applyChanges())
+	updated, _ = updated.Update(cmd())
+	m = updated.(model)
+	if m.status != Reviewing || len(m.list.Items()) != 2 {
+		t.Fatalf("expected two links to review, got status %d and %d items", m.status, len(m.list.Items()))
+	}
+
+	// Leave the report link alone.
+	m.list.Select(0)
+	m.toggleLinkItem()
+
+	updated, cmd = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+	if msg := cmd().(applyChangesMsg); msg.err != nil {
+		t.Fatal(msg.err)
+	}
+	if m = updated.(model); m.status != Finished {
+		t.Fatalf("expected status Finished, got %d", m.status)
+	}
+
+	b, err := fs.ReadFile(fsys, "notes.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "[report](report.pdf) ![img](docs/img.png)\n"; string(b) != expected {
+		t.Fatalf("expected: %q got: %q", expected, b)
+	}
+}
+
+func TestApplyIntoVacated(t *testing.T) {
+	m, fsys := testModel(t, "a.txt", "b.txt")
+	m.updateResults([]llm.Action{
+		{Type: "move", Name: "a.txt", Result: "b.txt"},
+		{Type: "move", Name: "b.txt", Result: "old/b.txt"},
+	})
+	m.status = Ready
+
+	if msg := m.applyChanges().(applyChangesMsg); msg.err != nil {
+		t.Fatal(msg.err)
+	}
+	for name, expected := range map[string]string{"b.txt": "a.txt", "old/b.txt": "b.txt"} {
+		if b, err := fs.ReadFile(fsys, name); err != nil || string(b) != expected {
+			t.Errorf("expected %s to hold %q, got %q %v", name, expected, b, err)
+		}
+	}
+}
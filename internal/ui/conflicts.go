@@ -0,0 +1,252 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/atlomak/norbot/internal/fsutils"
+	"github.com/atlomak/norbot/internal/llm"
+)
+
+// ConflictStrategy decides what happens to a planned move whose destination
+// is already taken, either on disk or by another planned action.
+type ConflictStrategy int
+
+const (
+	SuffixStrategy ConflictStrategy = iota
+	TimestampStrategy
+	SkipStrategy
+	MergeStrategy
+)
+
+var conflictStrategyNames = map[ConflictStrategy]string{
+	SuffixStrategy:    "suffix",
+	TimestampStrategy: "timestamp",
+	SkipStrategy:      "skip",
+	MergeStrategy:     "merge",
+}
+
+func (s ConflictStrategy) String() string {
+	return conflictStrategyNames[s]
+}
+
+func ParseConflictStrategy(name string) (ConflictStrategy, error) {
+	for s, n := range conflictStrategyNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return SuffixStrategy, fmt.Errorf("unknown conflict strategy: %s", name)
+}
+
+const timestampFormat = "20060102-150405"
+
+type conflictResolver struct {
+	strategy ConflictStrategy
+	now      time.Time
+	fsys     fsutils.FS
+	taken    map[string]bool
+	// vacated are the paths moves settled so far take their files from,
+	// free for others to move to.
+	vacated map[string]bool
+}
+
+func newConflictResolver(fsys fsutils.FS, strategy ConflictStrategy) *conflictResolver {
+	return &conflictResolver{
+		strategy: strategy,
+		now:      time.Now(),
+		fsys:     fsys,
+	}
+}
+
+// resolve returns actions with every destination collision settled by the
+// resolver strategy, and the original result of each action it changed,
+// keyed by action name. A destination another move takes a file away from
+// is free, unless the moves go round in a circle.
+func (r *conflictResolver) resolve(actions []llm.Action) ([]llm.Action, map[string]string) {
+	r.taken = make(map[string]bool)
+	r.vacated = make(map[string]bool)
+	resolved := make(map[string]string)
+
+	// Files that stay in place claim their names before anything moves.
+	for _, action := range actions {
+		if action.Type != "move" {
+			r.taken[cleanPath(action.Result)] = true
+		}
+	}
+
+	// A move waits for the move vacating its destination to be settled,
+	// the ones left waiting move in a circle.
+	settled := make([][]llm.Action, len(actions))
+	waiting := make(map[string]bool)
+	for _, action := range actions {
+		if action.Type == "move" {
+			waiting[cleanPath(action.Name)] = true
+		}
+	}
+	for progress := true; progress; {
+		progress = false
+		for i, action := range actions {
+			if action.Type != "move" || settled[i] != nil {
+				continue
+			}
+			if p := cleanPath(action.Result); waiting[p] && p != cleanPath(action.Name) {
+				continue
+			}
+			settled[i] = r.settleMove(action, resolved)
+			delete(waiting, cleanPath(action.Name))
+			progress = true
+		}
+	}
+
+	results := make([]llm.Action, 0, len(actions))
+	for i, action := range actions {
+		switch {
+		case action.Type != "move":
+			results = append(results, action)
+		case settled[i] != nil:
+			results = append(results, settled[i]...)
+		default:
+			results = append(results, r.settleMove(action, resolved)...)
+		}
+	}
+	return results, resolved
+}
+
+// settleMove returns action, or what it becomes if its destination is
+// occupied, and records the changed results in resolved.
+func (r *conflictResolver) settleMove(action llm.Action, resolved map[string]string) []llm.Action {
+	var results []llm.Action
+	if !r.occupied(action.Result, action.Name) {
+		r.taken[cleanPath(action.Result)] = true
+		results = []llm.Action{action}
+	} else {
+		log.Printf("conflict: %s -> %s, strategy: %s", action.Name, action.Result, r.strategy)
+		for _, a := range r.settle(action) {
+			if a.Result != action.Result {
+				resolved[a.Name] = action.Result
+			}
+			results = append(results, a)
+		}
+	}
+	for _, a := range results {
+		if a.Type == "move" && cleanPath(a.Result) != cleanPath(a.Name) {
+			r.vacated[cleanPath(a.Name)] = true
+		}
+	}
+	return results
+}
+
+func (r *conflictResolver) settle(action llm.Action) []llm.Action {
+	switch r.strategy {
+	case SkipStrategy:
+		action.Type = "keep"
+		action.Result = action.Name
+		r.taken[cleanPath(action.Name)] = true
+		return []llm.Action{action}
+	case MergeStrategy:
+		if merged, ok := r.merge(action); ok {
+			return merged
+		}
+	case TimestampStrategy:
+		action.Result = r.free(action.Name, withSuffix(action.Result, r.now.Format(timestampFormat)))
+		return []llm.Action{action}
+	}
+	action.Result = r.free(action.Name, action.Result)
+	return []llm.Action{action}
+}
+
+// merge moves the contents of a directory into an already existing one
+// instead of moving the directory itself, merging subdirectories the same
+// way. Colliding files get suffixes.
+func (r *conflictResolver) merge(action llm.Action) ([]llm.Action, bool) {
+	if !strings.HasSuffix(action.Name, "/") || !strings.HasSuffix(action.Result, "/") {
+		return nil, false
+	}
+	if r.vacated[cleanPath(action.Result)] {
+		return nil, false
+	}
+	if info, err := r.fsys.Lstat(cleanPath(action.Result)); err != nil || !info.IsDir() {
+		return nil, false
+	}
+	entries, err := r.fsys.ReadDir(cleanPath(action.Name))
+	if err != nil {
+		log.Printf("merge %s: %s", action.Name, err)
+		return nil, false
+	}
+
+	merged := make([]llm.Action, 0, len(entries))
+	for _, entry := range entries {
+		name := action.Name + entry.Name()
+		result := action.Result + entry.Name()
+		if entry.IsDir() {
+			name += "/"
+			result += "/"
+			if sub, ok := r.merge(llm.Action{Name: name, Type: "move", Result: result}); ok {
+				merged = append(merged, sub...)
+				continue
+			}
+		}
+		merged = append(merged, llm.Action{Name: name, Type: "move", Result: r.free(name, result)})
+	}
+	return merged, true
+}
+
+// free returns result, or the first numbered variant of it, that is not
+// occupied, and claims it.
+func (r *conflictResolver) free(name, result string) string {
+	candidate := result
+	for i := 1; r.occupied(candidate, name); i++ {
+		candidate = withSuffix(result, fmt.Sprint(i))
+	}
+	r.taken[cleanPath(candidate)] = true
+	return candidate
+}
+
+func (r *conflictResolver) occupied(result, name string) bool {
+	p := cleanPath(result)
+	if r.taken[p] {
+		return true
+	}
+	if p == cleanPath(name) {
+		return false
+	}
+	info, err := r.fsys.Lstat(p)
+	if errors.Is(err, fs.ErrNotExist) || r.vacated[p] {
+		return false
+	}
+	// A case or normalization only rename finds its own source on
+	// filesystems that do not tell the spellings apart.
+	if fsutils.ComparePaths(p, cleanPath(name)) != fsutils.DifferentPaths {
+		if src, err := r.fsys.Lstat(cleanPath(name)); err == nil && r.fsys.SameFile(info, src) {
+			return false
+		}
+	}
+	return true
+}
+
+// withSuffix inserts "_suffix" before the extension of the last element.
+func withSuffix(p, suffix string) string {
+	isDir := strings.HasSuffix(p, "/")
+	p = cleanPath(p)
+	dir, base := path.Split(p)
+
+	ext := path.Ext(base)
+	if isDir || ext == base {
+		ext = ""
+	}
+	p = dir + strings.TrimSuffix(base, ext) + "_" + suffix + ext
+	if isDir {
+		p += "/"
+	}
+	return p
+}
+
+func cleanPath(p string) string {
+	return strings.TrimSuffix(p, "/")
+}
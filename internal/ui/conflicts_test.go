@@ -0,0 +1,222 @@
+package ui
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atlomak/norbot/internal/fsutils"
+	"github.com/atlomak/norbot/internal/llm"
+)
+
+func testResolver(strategy ConflictStrategy, disk *fsutils.MemFS) *conflictResolver {
+	r := newConflictResolver(disk, strategy)
+	r.now = time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	return r
+}
+
+func TestResolveConflicts(t *testing.T) {
+	disk := fsutils.NewMemFS()
+	for _, name := range []string{
+		"a.txt",
+		"b.txt",
+		"docs/a.txt",
+		"docs/a_1.txt",
+		"old/x.txt",
+		"old/a.txt",
+		"Photos/a.txt",
+		"src/sub/y.txt",
+		"src/z.txt",
+		"dst/sub/y.txt",
+	} {
+		if err := disk.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		strategy ConflictStrategy
+		actions  []llm.Action
+		expected []llm.Action
+		resolved map[string]string
+	}{
+		{
+			name:     "No conflicts",
+			strategy: SuffixStrategy,
+			actions: []llm.Action{
+				{Type: "move", Name: "a.txt", Result: "texts/a.txt"},
+				{Type: "keep", Name: "b.txt", Result: "b.txt"},
+			},
+			expected: []llm.Action{
+				{Type: "move", Name: "a.txt", Result: "texts/a.txt"},
+				{Type: "keep", Name: "b.txt", Result: "b.txt"},
+			},
+			resolved: map[string]string{},
+		},
+		{
+			name:     "Suffix on disk collision",
+			strategy: SuffixStrategy,
+			actions: []llm.Action{
+				{Type: "move", Name: "a.txt", Result: "docs/a.txt"},
+			},
+			expected: []llm.Action{
+				{Type: "move", Name: "a.txt", Result: "docs/a_2.txt"},
+			},
+			resolved: map[string]string{"a.txt": "docs/a.txt"},
+		},
+		{
+			name:     "Suffix on planned collision",
+			strategy: SuffixStrategy,
+			actions: []llm.Action{
+				{Type: "move", Name: "a.txt", Result: "texts/notes.txt"},
+				{Type: "move", Name: "b.txt", Result: "texts/notes.txt"},
+			},
+			expected: []llm.Action{
+				{Type: "move", Name: "a.txt", Result: "texts/notes.txt"},
+				{Type: "move", Name: "b.txt", Result: "texts/notes_1.txt"},
+			},
+			resolved: map[string]string{"b.txt": "texts/notes.txt"},
+		},
+		{
+			name:     "Move onto kept file",
+			strategy: SuffixStrategy,
+			actions: []llm.Action{
+				{Type: "move", Name: "a.txt", Result: "c.txt"},
+				{Type: "keep", Name: "c.txt", Result: "c.txt"},
+			},
+			expected: []llm.Action{
+				{Type: "move", Name: "a.txt", Result: "c_1.txt"},
+				{Type: "keep", Name: "c.txt", Result: "c.txt"},
+			},
+			resolved: map[string]string{"a.txt": "c.txt"},
+		},
+		{
+			name:     "Timestamp",
+			strategy: TimestampStrategy,
+			actions: []llm.Action{
+				{Type: "move", Name: "a.txt", Result: "docs/a.txt"},
+			},
+			expected: []llm.Action{
+				{Type: "move", Name: "a.txt", Result: "docs/a_20240102-150405.txt"},
+			},
+			resolved: map[string]string{"a.txt": "docs/a.txt"},
+		},
+		{
+			name:     "Skip",
+			strategy: SkipStrategy,
+			actions: []llm.Action{
+				{Type: "move", Name: "a.txt", Result: "docs/a.txt"},
+			},
+			expected: []llm.Action{
+				{Type: "keep", Name: "a.txt", Result: "a.txt"},
+			},
+			resolved: map[string]string{"a.txt": "docs/a.txt"},
+		},
+		{
+			name:     "Merge directories",
+			strategy: MergeStrategy,
+			actions: []llm.Action{
+				{Type: "move", Name: "old/", Result: "Photos/"},
+			},
+			expected: []llm.Action{
+				{Type: "move", Name: "old/a.txt", Result: "Photos/a_1.txt"},
+				{Type: "move", Name: "old/x.txt", Result: "Photos/x.txt"},
+			},
+			resolved: map[string]string{"old/a.txt": "Photos/", "old/x.txt": "Photos/"},
+		},
+		{
+			name:     "Merge subdirectories",
+			strategy: MergeStrategy,
+			actions: []llm.Action{
+				{Type: "move", Name: "src/", Result: "dst/"},
+			},
+			expected: []llm.Action{
+				{Type: "move", Name: "src/sub/y.txt", Result: "dst/sub/y_1.txt"},
+				{Type: "move", Name: "src/z.txt", Result: "dst/z.txt"},
+			},
+			resolved: map[string]string{"src/sub/y.txt": "dst/", "src/z.txt": "dst/"},
+		},
+		{
+			name:     "Move to a place another move vacates",
+			strategy: SuffixStrategy,
+			actions: []llm.Action{
+				{Type: "move", Name: "a.txt", Result: "docs/a.txt"},
+				{Type: "move", Name: "docs/a.txt", Result: "archive/a.txt"},
+			},
+			expected: []llm.Action{
+				{Type: "move", Name: "a.txt", Result: "docs/a.txt"},
+				{Type: "move", Name: "docs/a.txt", Result: "archive/a.txt"},
+			},
+			resolved: map[string]string{},
+		},
+		{
+			name:     "Moves in a circle",
+			strategy: SuffixStrategy,
+			actions: []llm.Action{
+				{Type: "move", Name: "a.txt", Result: "b.txt"},
+				{Type: "move", Name: "b.txt", Result: "a.txt"},
+			},
+			expected: []llm.Action{
+				{Type: "move", Name: "a.txt", Result: "b_1.txt"},
+				{Type: "move", Name: "b.txt", Result: "a.txt"},
+			},
+			resolved: map[string]string{"a.txt": "b.txt"},
+		},
+		{
+			name:     "Merge falls back to suffix for files",
+			strategy: MergeStrategy,
+			actions: []llm.Action{
+				{Type: "move", Name: "a.txt", Result: "b.txt"},
+			},
+			expected: []llm.Action{
+				{Type: "move", Name: "a.txt", Result: "b_1.txt"},
+			},
+			resolved: map[string]string{"a.txt": "b.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, resolved := testResolver(tt.strategy, disk).resolve(tt.actions)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("resolve() = %v, want %v", got, tt.expected)
+			}
+			if !reflect.DeepEqual(resolved, tt.resolved) {
+				t.Errorf("resolved = %v, want %v", resolved, tt.resolved)
+			}
+		})
+	}
+}
+
+func TestWithSuffix(t *testing.T) {
+	tests := map[string]string{
+		"a.txt":        "a_1.txt",
+		"dir/a.tar.gz": "dir/a.tar_1.gz",
+		"Photos/":      "Photos_1/",
+		".bashrc":      ".bashrc_1",
+		"dir/no_ext":   "dir/no_ext_1",
+		"dir/v1.2/":    "dir/v1.2_1/",
+	}
+	for in, expected := range tests {
+		if got := withSuffix(in, "1"); got != expected {
+			t.Errorf("withSuffix(%s) = %s, want %s", in, got, expected)
+		}
+	}
+}
+
+func TestParseConflictStrategy(t *testing.T) {
+	for _, name := range []string{"suffix", "timestamp", "skip", "merge"} {
+		s, err := ParseConflictStrategy(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.String() != name {
+			t.Errorf("expected: %s got: %s", name, s)
+		}
+	}
+	if _, err := ParseConflictStrategy("overwrite"); err == nil || !strings.Contains(err.Error(), "overwrite") {
+		t.Errorf("expected error for unknown strategy, got: %v", err)
+	}
+}
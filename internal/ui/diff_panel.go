@@ -0,0 +1,115 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// change is what the plan does to an item, as highlighted by the diff view.
+type change int
+
+const (
+	unchanged change = iota
+	created
+	moved
+	renamed
+)
+
+var paneTitleStyle = lipgloss.NewStyle().PaddingLeft(4)
+
+// changeStyles color the changes, as set by applyTheme.
+var changeStyles = map[change]lipgloss.Style{}
+
+// changeMarks tell changes apart without colors.
+var changeMarks = map[change]string{
+	unchanged: "  ",
+	created:   "+ ",
+	moved:     "→ ",
+	renamed:   "~ ",
+}
+
+func diffLegend() string {
+	return fmt.Sprintf("+ new directory   %s moved   ~ renamed", icons.moved)
+}
+
+// changeOf classifies an item. A file moved to another directory counts as
+// moved even if its name changes too.
+func changeOf(it item) change {
+	switch {
+	case it.rejected:
+		return unchanged
+	case it.action == "create":
+		return created
+	case it.action != "move" || it.name == it.result:
+		return unchanged
+	case parentOf(it.name) == parentOf(it.result):
+		return renamed
+	}
+	return moved
+}
+
+// diffRows returns the current and the proposed tree, both fully expanded.
+func (m model) diffRows() (current, proposed []list.Item) {
+	none := map[string]bool{}
+	current = buildTree(m.items, currentPath).rows(m.items, none)
+	proposed = buildTree(m.items, proposedPath(m.items)).rows(m.items, none)
+	return current, proposed
+}
+
+func (m model) diffHeight() int {
+	// The pane titles and the legend take a line each.
+	return max(m.list.Height()-2, 1)
+}
+
+// scrollDiff moves both panes of the diff view together by delta lines.
+func (m *model) scrollDiff(delta int) {
+	current, proposed := m.diffRows()
+	last := max(len(current), len(proposed)) - m.diffHeight()
+	m.diffOffset = min(max(m.diffOffset+delta, 0), max(last, 0))
+}
+
+func (m model) diffView() string {
+	width := max((m.list.Width()-3)/2, 10)
+	current, proposed := m.diffRows()
+
+	left := []string{paneTitleStyle.Render(fmt.Sprintf("Current (%d)", len(current)))}
+	right := []string{paneTitleStyle.Render(fmt.Sprintf("Proposed (%d)", len(proposed)))}
+	for i := m.diffOffset; i < m.diffOffset+m.diffHeight(); i++ {
+		left = append(left, renderDiffRow(current, i, width))
+		right = append(right, renderDiffRow(proposed, i, width))
+	}
+
+	panes := lipgloss.JoinHorizontal(lipgloss.Top,
+		lipgloss.NewStyle().Width(width).Render(strings.Join(left, "\n")),
+		" "+strings.TrimSpace(icons.pipe)+" ",
+		lipgloss.NewStyle().Width(width).Render(strings.Join(right, "\n")),
+	)
+	return lipgloss.JoinVertical(lipgloss.Left, panes, helpStyle.Render(diffLegend()))
+}
+
+// renderDiffRow draws row i of a pane, cut to width, or an empty line past
+// the end of the tree.
+func renderDiffRow(rows []list.Item, i, width int) string {
+	if i >= len(rows) {
+		return ""
+	}
+	row := rows[i].(treeRow)
+
+	c := unchanged
+	if row.node.item >= 0 {
+		c = changeOf(row.item)
+	}
+	icon := icons.file
+	if row.node.isDir() {
+		icon = icons.dir
+	}
+	line := fmt.Sprintf("%s%s%s %s", changeMarks[c], row.prefix, icon, row.node.name)
+	line = lipgloss.NewStyle().MaxWidth(width).Render(line)
+	if style, ok := changeStyles[c]; ok {
+		return style.Render(line)
+	}
+	return line
+}
@@ -0,0 +1,74 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/atlomak/norbot/internal/llm"
+	"github.com/charmbracelet/x/ansi"
+)
+
+func TestChangeOf(t *testing.T) {
+	tests := []struct {
+		it       item
+		expected change
+	}{
+		{item{action: "create", result: "docs/"}, created},
+		{item{name: "a.txt", action: "move", result: "docs/a.txt"}, moved},
+		{item{name: "docs/IMG 1.jpg", action: "move", result: "docs/img_1.jpg"}, renamed},
+		{item{name: "a.txt", action: "move", result: "docs/b.txt"}, moved},
+		{item{name: "a.txt", action: "keep", result: "a.txt"}, unchanged},
+		{item{name: "a.txt", action: "keep", result: "a.txt", rejected: true}, unchanged},
+		{item{action: "!create", result: "docs/", rejected: true}, unchanged},
+	}
+	for _, tt := range tests {
+		if got := changeOf(tt.it); got != tt.expected {
+			t.Errorf("changeOf(%v) = %d, want %d", tt.it, got, tt.expected)
+		}
+	}
+}
+
+func TestDiffView(t *testing.T) {
+	m, _ := testModel(t, "IMG 1.jpg", "notes.txt", "report.pdf")
+	m.list.SetSize(80, 5)
+	m.updateResults([]llm.Action{
+		{Type: "move", Name: "IMG 1.jpg", Result: "photos/img_1.jpg"},
+		{Type: "move", Name: "notes.txt", Result: "todo.txt"},
+		{Type: "keep", Name: "report.pdf", Result: "report.pdf"},
+	})
+
+	view := ansi.Strip(m.diffView())
+	lines := strings.Split(view, "\n")
+	for i, expected := range []string{
+		"Current (3)",
+		"→ " + icons.file + " IMG 1.jpg",
+		"~ " + icons.file + " notes.txt",
+	} {
+		if !strings.Contains(lines[i], expected) {
+			t.Errorf("expected %q in line %d of:\n%s", expected, i, view)
+		}
+	}
+	for i, expected := range []string{
+		"Proposed (4)",
+		"+ " + icons.dir + " photos",
+		"→ └─" + icons.file + " img_1.jpg",
+	} {
+		if !strings.Contains(lines[i], expected) {
+			t.Errorf("expected %q in line %d of:\n%s", expected, i, view)
+		}
+	}
+
+	// Both panes scroll together, as far as the longer one goes.
+	m.scrollDiff(10)
+	if m.diffOffset != 1 {
+		t.Fatalf("expected offset 1, got %d", m.diffOffset)
+	}
+	lines = strings.Split(ansi.Strip(m.diffView()), "\n")
+	if !strings.Contains(lines[1], "notes.txt") || !strings.Contains(lines[1], "img_1.jpg") {
+		t.Fatalf("expected both panes to scroll, got:\n%s", strings.Join(lines, "\n"))
+	}
+	m.scrollDiff(-10)
+	if m.diffOffset != 0 {
+		t.Fatalf("expected offset 0, got %d", m.diffOffset)
+	}
+}
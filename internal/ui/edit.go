@@ -0,0 +1,225 @@
+package ui
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/atlomak/norbot/internal/fsutils"
+	"github.com/atlomak/norbot/internal/llm"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxCompletions limits the directories listed below the edit input.
+const maxCompletions = 5
+
+// replan turns the plan into items again, after it changed. Directories
+// are created for new destinations, the ones nothing needs anymore go away,
+// and rejected items stay rejected.
+func (m *model) replan() tea.Cmd {
+	// Files are known by name, new directories by where they go.
+	rejected := make(map[string]bool)
+	for _, it := range m.items {
+		if it.rejected {
+			rejected[it.name+"\x00"+it.result] = true
+		}
+	}
+
+	m.maxDepth = maxDepth(m.plan)
+	m.actions = generateActionMapWithDirs(m.plan)
+	m.warnings = append(scanWarnings(m.files), caseConflicts(m.actions)...)
+	m.items = m.resultsToItems(m.actions)
+	revised := make(map[string]string)
+	for _, c := range m.changes {
+		revised[c.name] = c.before
+	}
+	for i, it := range m.items {
+		if before, ok := revised[it.name]; ok {
+			m.items[i].revised = before
+		}
+		key := it.name + "\x00" + it.name
+		if it.name == "" {
+			key = "\x00" + it.result
+		}
+		if rejected[key] && !it.rejected {
+			m.items[i] = m.toggleItemAction(it)
+		}
+	}
+	return m.refreshTree()
+}
+
+// retarget changes the destination of the item name to result, as typed by
+// the user. A file given a directory ending in a slash moves into it.
+func (m *model) retarget(name, result string) (tea.Cmd, error) {
+	result, err := destination(name, result)
+	if err != nil {
+		return nil, err
+	}
+	return m.setDestinations(map[string]string{name: result}), nil
+}
+
+// destination cleans up a path typed for the item name.
+func destination(name, result string) (string, error) {
+	result = strings.TrimPrefix(strings.TrimSpace(result), "./")
+	isDir := strings.HasSuffix(name, "/")
+	if strings.HasSuffix(result, "/") && !isDir {
+		result += path.Base(name)
+	}
+	result = path.Clean(result)
+	if !fs.ValidPath(result) || result == "." {
+		return "", fmt.Errorf("not a path inside the directory: %s", result)
+	}
+	if isDir {
+		result += "/"
+	}
+	return result, nil
+}
+
+// setDestinations replaces the destinations of items in the plan, keyed by
+// name, and settles any collisions the new ones cause.
+func (m *model) setDestinations(results map[string]string) tea.Cmd {
+	// Giving an item a new destination accepts it again.
+	for i, it := range m.items {
+		if _, ok := results[it.name]; ok {
+			m.items[i].rejected = false
+		}
+	}
+
+	plan := make([]llm.Action, 0, len(m.plan)+len(results))
+	for _, a := range m.plan {
+		if _, ok := results[a.Name]; !ok {
+			plan = append(plan, a)
+		}
+	}
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		action := llm.Action{Type: "move", Name: name, Result: results[name]}
+		if action.Result == name {
+			action.Type = "keep"
+		}
+		plan = append(plan, action)
+		delete(m.resolved, name)
+	}
+
+	plan, resolved := newConflictResolver(m.fsys, m.options.Conflicts).resolve(plan)
+	for k, v := range resolved {
+		m.resolved[k] = v
+	}
+	m.plan = plan
+	return m.replan()
+}
+
+// plannedDirs lists the directories that exist or are part of the plan.
+func (m model) plannedDirs() []string {
+	seen := make(map[string]bool)
+	m.files.Walk(func(name string, n fsutils.Node) {
+		if n.Kind == fsutils.DirNode {
+			seen[name] = true
+		}
+	})
+	for _, action := range m.actions {
+		if strings.HasSuffix(action.Result, "/") {
+			seen[action.Result] = true
+		}
+	}
+
+	dirs := make([]string, 0, len(seen))
+	for dir := range seen {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// complete extends value as far as all directories starting with it agree,
+// and returns the ones that matched.
+func complete(value string, dirs []string) (string, []string) {
+	var matches []string
+	for _, dir := range dirs {
+		if strings.HasPrefix(dir, value) {
+			matches = append(matches, dir)
+		}
+	}
+	if len(matches) == 0 {
+		return value, nil
+	}
+
+	prefix := matches[0]
+	for _, match := range matches[1:] {
+		for !strings.HasPrefix(match, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	for !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+	return prefix, matches
+}
+
+// startEdit opens the edit input for the selected item, filled with its
+// current destination, or for the folder to move the marked items into.
+func (m *model) startEdit() tea.Cmd {
+	if len(m.selection()) > 0 {
+		m.status = Editing
+		m.editing = ""
+		m.completions, m.editErr = nil, nil
+		m.editInput.SetValue("")
+		return m.editInput.Focus()
+	}
+
+	row, ok := m.list.SelectedItem().(treeRow)
+	if !ok || row.node.item < 0 || row.item.name == "" || row.item.immovable {
+		return nil
+	}
+	m.status = Editing
+	m.editing = row.item.name
+	m.completions, m.editErr = nil, nil
+	m.editInput.SetValue(row.item.result)
+	m.editInput.CursorEnd()
+	return m.editInput.Focus()
+}
+
+func (m model) updateEdit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keys.forceQuit):
+		return m, tea.Quit
+	case key.Matches(msg, m.keys.cancel):
+		m.status = Ready
+		m.editInput.Blur()
+		return m, nil
+	case key.Matches(msg, m.keys.complete):
+		value, matches := complete(m.editInput.Value(), m.plannedDirs())
+		m.editInput.SetValue(value)
+		m.editInput.CursorEnd()
+		m.completions = matches
+		return m, nil
+	case key.Matches(msg, m.keys.confirm):
+		var cmd tea.Cmd
+		var err error
+		if m.editing == "" {
+			cmd, err = m.retargetSelection(m.editInput.Value())
+		} else {
+			cmd, err = m.retarget(m.editing, m.editInput.Value())
+		}
+		if err != nil {
+			m.editErr = err
+			return m, nil
+		}
+		m.status = Ready
+		m.editInput.Blur()
+		return m, cmd
+	}
+
+	var cmd tea.Cmd
+	m.editInput, cmd = m.editInput.Update(msg)
+	m.completions = nil
+	return m, cmd
+}
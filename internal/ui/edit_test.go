@@ -0,0 +1,107 @@
+package ui
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/atlomak/norbot/internal/llm"
+)
+
+func planString(items []item) []string {
+	var got []string
+	for _, it := range items {
+		s := it.action + " " + it.name + " -> " + it.result
+		if it.rejected {
+			s = "x " + s
+		}
+		got = append(got, s)
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestRetarget(t *testing.T) {
+	m, _ := testModel(t, "IMG 1.jpg", "notes.txt", "report.pdf")
+	m.updateResults([]llm.Action{
+		{Type: "move", Name: "IMG 1.jpg", Result: "photos/img_1.jpg"},
+		{Type: "move", Name: "notes.txt", Result: "texts/notes.txt"},
+		{Type: "move", Name: "report.pdf", Result: "texts/report.pdf"},
+	})
+	for i, it := range m.items {
+		if it.name == "report.pdf" {
+			m.items[i] = m.toggleItemAction(it)
+		}
+	}
+
+	if _, err := m.retarget("IMG 1.jpg", "media/2024/"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"create  -> media/",
+		"create  -> media/2024/",
+		"create  -> texts/",
+		"move IMG 1.jpg -> media/2024/IMG 1.jpg",
+		"move notes.txt -> texts/notes.txt",
+		"x keep report.pdf -> report.pdf",
+	}
+	if got := planString(m.items); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("\nexpected: %q\ngot:      %q", expected, got)
+	}
+
+	if _, err := m.retarget("notes.txt", "./notes.txt"); err != nil {
+		t.Fatal(err)
+	}
+	// report.pdf could be accepted again, so texts/ stays.
+	expected = []string{
+		"create  -> media/",
+		"create  -> media/2024/",
+		"create  -> texts/",
+		"keep notes.txt -> notes.txt",
+		"move IMG 1.jpg -> media/2024/IMG 1.jpg",
+		"x keep report.pdf -> report.pdf",
+	}
+	if got := planString(m.items); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("\nexpected: %q\ngot:      %q", expected, got)
+	}
+
+	if _, err := m.retarget("notes.txt", "../notes.txt"); err == nil {
+		t.Fatal("expected a path outside the directory to be refused")
+	}
+}
+
+func TestRetargetResolvesConflicts(t *testing.T) {
+	m, _ := testModel(t, "a.txt", "b.txt", "docs/a.txt")
+	m.updateResults([]llm.Action{
+		{Type: "keep", Name: "a.txt", Result: "a.txt"},
+		{Type: "keep", Name: "b.txt", Result: "b.txt"},
+	})
+	if _, err := m.retarget("b.txt", "docs/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	for _, it := range m.items {
+		if it.name == "b.txt" && (it.result != "docs/a_1.txt" || it.conflict != "docs/a.txt") {
+			t.Fatalf("expected b.txt to be resolved to docs/a_1.txt, got %v", it)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	dirs := []string{"docs/", "docs/2023/", "docs/2024/", "photos/"}
+	tests := []struct {
+		value    string
+		expected string
+		matches  int
+	}{
+		{"p", "photos/", 1},
+		{"docs/2", "docs/202", 2},
+		{"d", "docs/", 3},
+		{"x", "x", 0},
+	}
+	for _, tt := range tests {
+		got, matches := complete(tt.value, dirs)
+		if got != tt.expected || len(matches) != tt.matches {
+			t.Errorf("complete(%q) = %q, %d matches, want %q, %d", tt.value, got, len(matches), tt.expected, tt.matches)
+		}
+	}
+}
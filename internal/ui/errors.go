@@ -0,0 +1,264 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/atlomak/norbot/internal/fsutils"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+// failure is an error Norbot ran into, with the way back to where it was
+// and, if the step can be taken again, the way to retry it.
+type failure struct {
+	// op tells what Norbot was doing, as in "while <op>".
+	op    string
+	err   error
+	retry func(m *model) tea.Cmd
+	back  func(m *model) tea.Cmd
+	// report is shown in place of err, for an apply that failed in part.
+	report *applyReport
+}
+
+// failureOf tells what failed from the message that brought err.
+func (m model) failureOf(err error, msg tea.Msg) *failure {
+	switch msg := msg.(type) {
+	case readDirMsg:
+		previous := m.status
+		return &failure{
+			op:    "reading the files",
+			err:   err,
+			retry: func(m *model) tea.Cmd { m.status = previous; return m.rescan() },
+			back:  func(m *model) tea.Cmd { m.status = previous; return nil },
+		}
+	case queryResultMsg:
+		return &failure{
+			op:    "asking for a plan",
+			err:   err,
+			retry: func(m *model) tea.Cmd { m.status = Waiting; return msg.stream.retry(m) },
+			back:  func(m *model) tea.Cmd { return m.restorePlan() },
+		}
+	case applyChangesMsg:
+		if msg.links {
+			// Files updated before the failure are skipped on retry.
+			return &failure{
+				op:    "updating links",
+				err:   err,
+				retry: func(m *model) tea.Cmd { m.status = Finished; return m.applyLinkEdits },
+				back:  func(m *model) tea.Cmd { m.status = Reviewing; return nil },
+			}
+		}
+		return &failure{
+			op:     "applying the changes",
+			err:    err,
+			retry:  func(m *model) tea.Cmd { m.status = Finished; return m.applyChanges },
+			back:   func(m *model) tea.Cmd { m.status = Ready; return nil },
+			report: msg.report,
+		}
+	case linkEditsMsg:
+		return &failure{
+			op:    "looking for broken links",
+			err:   err,
+			retry: func(m *model) tea.Cmd { m.status = Finished; return findLinkEdits(m.fsys, msg.moves) },
+			back:  func(m *model) tea.Cmd { m.status = Finished; return m.rescan() },
+		}
+	}
+	previous := m.status
+	return &failure{op: "working", err: err, back: func(m *model) tea.Cmd { m.status = previous; return nil }}
+}
+
+// classify sums up err for the user, with a hint on what to do about it.
+func classify(err error) (summary, hint string) {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, fsutils.ErrNotJournaled):
+		return "A change was made but not journaled.", "Undo will not revert it, check that the journal can be written."
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, syscall.ETIMEDOUT):
+		return "The request timed out.", "Check your connection and retry."
+	case errors.Is(err, fs.ErrPermission):
+		return "Permission denied.", "Check who owns the files, or run Norbot where you can write."
+	case errors.Is(err, syscall.ENOSPC):
+		return "The disk is full.", "Free some space and retry, what was done so far is kept."
+	case errors.Is(err, fsutils.ErrDestinationExists) || errors.Is(err, fs.ErrExist):
+		return "A file is in the way.", "Something was created meanwhile, go back and change where the file goes."
+	case errors.Is(err, fsutils.ErrGitDirty):
+		return "A file has uncommitted changes.", "Commit or stash it and retry, or start Norbot with -allow-dirty."
+	case errors.Is(err, fs.ErrNotExist):
+		return "A file is gone.", "It was moved or deleted meanwhile, retry to skip what is done."
+	}
+	if s, ok := grpcstatus.FromError(err); ok && s.Code() != codes.Unknown {
+		switch s.Code() {
+		case codes.Unauthenticated, codes.PermissionDenied:
+			return "Gemini refused the API key.", "Check GEMINI_API_KEY."
+		case codes.InvalidArgument:
+			if strings.Contains(s.Message(), "API key") {
+				return "Gemini refused the API key.", "Check GEMINI_API_KEY."
+			}
+		case codes.ResourceExhausted:
+			return "Gemini's quota ran out.", "Wait a moment and retry."
+		case codes.Unavailable, codes.DeadlineExceeded:
+			return "Gemini could not be reached.", "Check your connection and retry."
+		}
+		return "Gemini returned an error.", "Retry, or see the details."
+	}
+	switch {
+	case errors.As(err, &netErr):
+		return "The network failed.", "Check your connection and retry."
+	case strings.Contains(err.Error(), "no plan in the response"):
+		return "Gemini's answer was not a plan.", "Retry, a new answer usually is."
+	}
+	return "Something went wrong.", "Retry, or see the details."
+}
+
+// errorChain lists err and every error it wraps, joined ones included.
+func errorChain(err error) []string {
+	var lines []string
+	var walk func(err error, depth int)
+	walk = func(err error, depth int) {
+		lines = append(lines, fmt.Sprintf("%s%s (%T)", strings.Repeat("  ", depth), err, err))
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			if next := e.Unwrap(); next != nil {
+				walk(next, depth+1)
+			}
+		case interface{ Unwrap() []error }:
+			for _, next := range e.Unwrap() {
+				walk(next, depth+1)
+			}
+		}
+	}
+	walk(err, 0)
+	return lines
+}
+
+// maxLogLines is how many lines a LogBuffer keeps.
+const maxLogLines = 500
+
+// LogBuffer keeps the last lines logged, to show them along with an error.
+// It is safe to write to from several goroutines.
+type LogBuffer struct {
+	mu    sync.Mutex
+	lines []string
+	// partial is a line written without its end yet.
+	partial string
+}
+
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lines := strings.Split(b.partial+string(p), "\n")
+	b.partial = lines[len(lines)-1]
+	b.lines = append(b.lines, lines[:len(lines)-1]...)
+	if len(b.lines) > maxLogLines {
+		b.lines = b.lines[len(b.lines)-maxLogLines:]
+	}
+	return len(p), nil
+}
+
+// Lines returns the lines logged so far, oldest first.
+func (b *LogBuffer) Lines() []string {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.lines...)
+}
+
+// detailsLines are the contents of the details pane.
+func (m model) detailsLines() []string {
+	lines := append([]string{previewTitleStyle.Render("Error")}, errorChain(m.failure.err)...)
+	lines = append(lines, "", previewTitleStyle.Render("Log"))
+	if logged := m.options.Log.Lines(); len(logged) > 0 {
+		lines = append(lines, logged...)
+	} else {
+		lines = append(lines, noteStyle.UnsetMarginLeft().Render("nothing logged"))
+	}
+	return lines
+}
+
+// scrollDetails moves the details pane by delta lines.
+func (m *model) scrollDetails(delta int) {
+	last := len(m.detailsLines()) - m.list.Height()
+	m.detailsOffset = max(min(m.detailsOffset+delta, last), 0)
+}
+
+// errorView draws the error under the status panel, or the details pane.
+func (m model) errorView() string {
+	width := max(m.list.Width()-rowIndent, 1)
+	if !m.details && m.failure.report != nil {
+		return lipgloss.JoinVertical(lipgloss.Left, m.reportView(), m.helpView())
+	}
+	if !m.details {
+		text := lipgloss.NewStyle().Width(width).Render(m.failure.err.Error())
+		return lipgloss.JoinVertical(lipgloss.Left, lipgloss.NewStyle().PaddingLeft(rowIndent).Render(text), "", m.helpView())
+	}
+
+	lines := m.detailsLines()
+	end := min(m.detailsOffset+m.list.Height(), len(lines))
+	var shown []string
+	for _, line := range lines[m.detailsOffset:end] {
+		shown = append(shown, ansi.Truncate(line, width, icons.ellipsis))
+	}
+	pane := lipgloss.NewStyle().PaddingLeft(rowIndent).Height(m.list.Height()).Render(strings.Join(shown, "\n"))
+	return lipgloss.JoinVertical(lipgloss.Left, pane, m.helpView())
+}
+
+// updateError handles keys while Norbot shows an error.
+func (m model) updateError(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.details {
+		switch {
+		case key.Matches(msg, m.keys.up):
+			m.scrollDetails(-1)
+			return m, nil
+		case key.Matches(msg, m.keys.down):
+			m.scrollDetails(1)
+			return m, nil
+		case key.Matches(msg, m.keys.pageUp):
+			m.scrollDetails(-m.list.Height())
+			return m, nil
+		case key.Matches(msg, m.keys.pageDown):
+			m.scrollDetails(m.list.Height())
+			return m, nil
+		}
+	} else if m.failure.report != nil {
+		if model, cmd, ok := m.updateReport(msg); ok {
+			return model, cmd
+		}
+	}
+
+	switch {
+	case key.Matches(msg, m.keys.quit):
+		return m, tea.Quit
+	case key.Matches(msg, m.keys.help):
+		m.showHelp = true
+		return m, nil
+	case key.Matches(msg, m.keys.details):
+		m.details = !m.details
+		m.detailsOffset = 0
+		return m, nil
+	case key.Matches(msg, m.keys.retry):
+		if m.failure.retry == nil {
+			return m, nil
+		}
+		f := m.failure
+		m.failure, m.details = nil, false
+		return m, f.retry(&m)
+	case key.Matches(msg, m.keys.cancel):
+		f := m.failure
+		m.failure, m.details = nil, false
+		return m, f.back(&m)
+	}
+	return m, nil
+}
@@ -0,0 +1,165 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/atlomak/norbot/internal/fsutils"
+	"github.com/atlomak/norbot/internal/llm"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{fmt.Errorf("failed to move file: %w", &fs.PathError{Op: "rename", Path: "a", Err: fs.ErrPermission}), "Permission denied."},
+		{fmt.Errorf("%w: docs/a.txt", fsutils.ErrDestinationExists), "A file is in the way."},
+		{fmt.Errorf("%w: %w", fsutils.ErrNotJournaled, fs.ErrPermission), "A change was made but not journaled."},
+		{fmt.Errorf("query: %w", grpcstatus.Error(codes.ResourceExhausted, "quota")), "Gemini's quota ran out."},
+		{grpcstatus.Error(codes.InvalidArgument, "API key not valid"), "Gemini refused the API key."},
+		{errors.New("no plan in the response"), "Gemini's answer was not a plan."},
+		{errors.New("boom"), "Something went wrong."},
+	}
+	for _, tt := range tests {
+		if got, _ := classify(tt.err); got != tt.expected {
+			t.Errorf("%v: expected %q, got %q", tt.err, tt.expected, got)
+		}
+	}
+}
+
+func TestErrorChain(t *testing.T) {
+	err := fmt.Errorf("apply: %w", errors.Join(fs.ErrNotExist, errors.New("second")))
+	expected := []string{
+		"apply: file does not exist\nsecond (*fmt.wrapError)",
+		"  file does not exist\nsecond (*errors.joinError)",
+		"    file does not exist (*errors.errorString)",
+		"    second (*errors.errorString)",
+	}
+	if got := errorChain(err); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("\nexpected: %q\ngot:      %q", expected, got)
+	}
+}
+
+func TestLogBuffer(t *testing.T) {
+	var b LogBuffer
+	fmt.Fprint(&b, "first\nsec")
+	fmt.Fprint(&b, "ond\n")
+	for i := 0; i < maxLogLines; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	lines := b.Lines()
+	if len(lines) != maxLogLines || lines[0] != "line 0" {
+		t.Fatalf("expected the last %d lines, got %d starting with %q", maxLogLines, len(lines), lines[0])
+	}
+
+	var short LogBuffer
+	fmt.Fprint(&short, "first\nsec")
+	fmt.Fprint(&short, "ond\n")
+	if got := short.Lines(); !reflect.DeepEqual(got, []string{"first", "second"}) {
+		t.Fatalf("expected whole lines, got %q", got)
+	}
+}
+
+func TestRetryApply(t *testing.T) {
+	m, fsys := testModel(t, "a.txt", "b.txt")
+	m.options.Log = &LogBuffer{}
+	m.options.UpdateLinks = true
+	m.updateResults([]llm.Action{
+		{Type: "move", Name: "a.txt", Result: "docs/a.txt"},
+		{Type: "move", Name: "b.txt", Result: "notes/b.txt"},
+	})
+	m.status = Ready
+	plan := planString(m.items)
+
+	// Something shows up where b.txt is going, after a.txt was moved.
+	if err := fsys.MkdirAll("notes/b.txt", 0755); err != nil {
+		t.Fatal(err)
+	}
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}})
+	m = next.(model)
+	next, _ = m.Update(m.applyChanges())
+	if m = next.(model); m.status != Error || m.failure.op != "applying the changes" {
+		t.Fatalf("expected the apply to fail, got status %d", m.status)
+	}
+
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	view := ansi.Strip(next.(model).View())
+	if !strings.Contains(view, "*fmt.wrapError") || !strings.Contains(view, "Log") {
+		t.Errorf("expected the error chain in the details:\n%s", view)
+	}
+
+	// Back to the plan, as it was.
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if m = next.(model); m.status != Ready || !reflect.DeepEqual(planString(m.items), plan) {
+		t.Fatalf("expected the plan back, got status %d and %q", m.status, planString(m.items))
+	}
+
+	// Retrying goes on from where the apply stopped.
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}})
+	m = next.(model)
+	next, _ = m.Update(m.applyChanges())
+	if m = next.(model); m.status != Error {
+		t.Fatalf("expected the apply to fail again, got status %d", m.status)
+	}
+	if err := fsys.Remove("notes/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	next, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'r'}})
+	if m = next.(model); m.status != Finished || cmd == nil {
+		t.Fatalf("expected a retry, got status %d", m.status)
+	}
+	msg := cmd().(applyChangesMsg)
+	if msg.err != nil {
+		t.Fatal(msg.err)
+	}
+	// The links of a.txt are looked at too, though it was moved before.
+	moves := map[string]string{"a.txt": "docs/a.txt", "b.txt": "notes/b.txt"}
+	if !reflect.DeepEqual(msg.moves, moves) {
+		t.Errorf("expected moves %v, got %v", moves, msg.moves)
+	}
+	next, cmd = m.Update(msg)
+	if cmd == nil {
+		t.Fatal("expected the links to be looked for")
+	}
+	if edits := cmd().(linkEditsMsg); !reflect.DeepEqual(edits.moves, moves) {
+		t.Errorf("expected links looked for after %v, got %v", moves, edits.moves)
+	}
+	for _, name := range []string{"docs/a.txt", "notes/b.txt"} {
+		if _, err := fsys.Lstat(name); err != nil {
+			t.Errorf("expected %s moved: %v", name, err)
+		}
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	m, _ := testModel(t, "a.txt")
+	retried := false
+	m.stream = &planStream{retry: func(m *model) tea.Cmd { retried = true; return nil }}
+	m.status = Waiting
+
+	next, _ := m.Update(queryResultMsg{stream: m.stream, err: grpcstatus.Error(codes.Unavailable, "unreachable")})
+	m = next.(model)
+	if view := ansi.Strip(m.View()); !strings.Contains(view, "asking for a plan") || !strings.Contains(view, "could not be reached") {
+		t.Errorf("expected a classified message:\n%s", view)
+	}
+
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'r'}})
+	if m = next.(model); !retried || m.status != Waiting {
+		t.Fatalf("expected the query retried, got status %d", m.status)
+	}
+
+	next, _ = m.Update(queryResultMsg{stream: m.stream, err: errors.New("boom")})
+	next, _ = next.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if m = next.(model); m.status != Started || m.failure != nil {
+		t.Fatalf("expected to start over without a plan, got status %d", m.status)
+	}
+}
@@ -0,0 +1,161 @@
+package ui
+
+import (
+	"path"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// filterTerm tells whether an item, placed at p by the plan, matches a term.
+type filterTerm func(it item, p string) bool
+
+// parseFilter turns a query into the terms an item has to match, all of
+// them. Besides text found in the current or proposed path, a term can be
+// action:<type>, dir:<directory>, ext:<extension>, rejected or revised.
+func parseFilter(query string) []filterTerm {
+	var terms []filterTerm
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		kind, value, _ := strings.Cut(word, ":")
+		switch {
+		case kind == "action" && value != "":
+			terms = append(terms, func(it item, _ string) bool {
+				return strings.TrimPrefix(it.action, "!") == value
+			})
+		case kind == "dir" && value != "":
+			dir := strings.TrimPrefix(strings.TrimSuffix(value, "/")+"/", "./")
+			terms = append(terms, func(it item, p string) bool {
+				return inDir(strings.ToLower(it.name), dir) || inDir(strings.ToLower(p), dir)
+			})
+		case kind == "ext" && value != "":
+			ext := "." + strings.TrimPrefix(value, ".")
+			terms = append(terms, func(it item, p string) bool {
+				return strings.ToLower(path.Ext(it.name)) == ext || strings.ToLower(path.Ext(p)) == ext
+			})
+		case word == "rejected":
+			terms = append(terms, func(it item, _ string) bool {
+				return it.rejected
+			})
+		case word == "revised":
+			terms = append(terms, func(it item, _ string) bool {
+				return it.revised != ""
+			})
+		default:
+			terms = append(terms, func(it item, p string) bool {
+				return strings.Contains(strings.ToLower(it.name), word) || strings.Contains(strings.ToLower(p), word)
+			})
+		}
+	}
+	return terms
+}
+
+// inDir reports whether p is somewhere inside dir, which ends in a slash.
+func inDir(p, dir string) bool {
+	return p != dir && strings.HasPrefix(p, dir)
+}
+
+// filtered returns which items the filter lets through, or nil if there is
+// no filter. New directories are shown when something inside them is.
+func (m model) filtered() map[int]bool {
+	terms := parseFilter(m.filter)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	place := proposedPath(m.items)
+	shown := make(map[int]bool)
+	var paths []string
+	for i, it := range m.items {
+		p := place(it)
+		match := true
+		for _, term := range terms {
+			if !term(it, p) {
+				match = false
+				break
+			}
+		}
+		if match {
+			shown[i] = true
+			paths = append(paths, p)
+		}
+	}
+	for i, it := range m.items {
+		if it.name != "" || shown[i] {
+			continue
+		}
+		for _, p := range paths {
+			if inDir(p, it.result) {
+				shown[i] = true
+				break
+			}
+		}
+	}
+	return shown
+}
+
+// shownCount returns how many items the filter lets through.
+func (m model) shownCount() int {
+	if shown := m.filtered(); shown != nil {
+		return len(shown)
+	}
+	return len(m.items)
+}
+
+// placeFiltered places the items like proposedPath, leaving out the ones
+// the filter hides.
+func (m model) placeFiltered() func(it item) string {
+	place := proposedPath(m.items)
+	shown := m.filtered()
+	if shown == nil {
+		return place
+	}
+	index := make(map[string]int, len(m.items))
+	for i, it := range m.items {
+		index[itemKey(it)] = i
+	}
+	return func(it item) string {
+		if !shown[index[itemKey(it)]] {
+			return ""
+		}
+		return place(it)
+	}
+}
+
+// startFilter opens the filter input with the current query.
+func (m *model) startFilter() tea.Cmd {
+	m.status = Filtering
+	m.filterInput.SetValue(m.filter)
+	m.filterInput.CursorEnd()
+	return m.filterInput.Focus()
+}
+
+// setFilter shows only the items matching query, an empty one shows all.
+func (m *model) setFilter(query string) tea.Cmd {
+	m.filter = strings.TrimSpace(query)
+	return m.refreshTree()
+}
+
+// markShown marks every item the filter lets through.
+func (m *model) markShown() {
+	m.markWhere(func(_, _ item) bool { return true })
+}
+
+func (m model) updateFilter(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keys.forceQuit):
+		return m, tea.Quit
+	case key.Matches(msg, m.keys.cancel):
+		m.status = Ready
+		m.filterInput.Blur()
+		return m, m.setFilter("")
+	case key.Matches(msg, m.keys.confirm):
+		m.status = Ready
+		m.filterInput.Blur()
+		return m, nil
+	}
+
+	var inputCmd tea.Cmd
+	m.filterInput, inputCmd = m.filterInput.Update(msg)
+	return m, tea.Batch(inputCmd, m.setFilter(m.filterInput.Value()))
+}
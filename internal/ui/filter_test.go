@@ -0,0 +1,71 @@
+package ui
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/atlomak/norbot/internal/llm"
+)
+
+func TestFilter(t *testing.T) {
+	m, _ := testModel(t, "IMG 1.jpg", "notes.txt", "report.pdf", "scan.PDF")
+	m.updateResults([]llm.Action{
+		{Type: "move", Name: "IMG 1.jpg", Result: "Photos/img_1.jpg"},
+		{Type: "move", Name: "notes.txt", Result: "texts/notes.txt"},
+		{Type: "keep", Name: "report.pdf", Result: "report.pdf"},
+		{Type: "move", Name: "scan.PDF", Result: "texts/scan.pdf"},
+	})
+	for i, it := range m.items {
+		if it.name == "notes.txt" {
+			m.items[i] = m.toggleItemAction(it)
+		}
+	}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"img", []string{"Photos/", "Photos/img_1.jpg"}},
+		{"action:move", []string{"Photos/", "Photos/img_1.jpg", "texts/", "texts/scan.pdf"}},
+		{"action:create", []string{"Photos/", "texts/"}},
+		{"dir:photos", []string{"Photos/", "Photos/img_1.jpg"}},
+		{"ext:pdf", []string{"report.pdf", "texts/", "texts/scan.pdf"}},
+		{"ext:.pdf action:keep", []string{"report.pdf"}},
+		{"rejected", []string{"notes.txt"}},
+		{"", []string{"Photos/", "Photos/img_1.jpg", "notes.txt", "report.pdf", "texts/", "texts/scan.pdf"}},
+	}
+	for _, tt := range tests {
+		m.setFilter(tt.query)
+		var got []string
+		for _, r := range m.list.Items() {
+			got = append(got, r.(treeRow).node.path)
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: expected %q, got %q", tt.query, tt.expected, got)
+		}
+	}
+}
+
+func TestMarkShown(t *testing.T) {
+	m, _ := testModel(t, "a.jpg", "b.jpg", "notes.txt")
+	m.updateResults([]llm.Action{
+		{Type: "move", Name: "a.jpg", Result: "photos/a.jpg"},
+		{Type: "move", Name: "b.jpg", Result: "photos/b.jpg"},
+		{Type: "move", Name: "notes.txt", Result: "texts/notes.txt"},
+	})
+
+	m.setFilter("ext:jpg")
+	m.markShown()
+	m.toggleSelection()
+	m.setFilter("")
+	expected := []string{
+		"create  -> texts/",
+		"move notes.txt -> texts/notes.txt",
+		"x !create  -> photos/",
+		"x keep a.jpg -> a.jpg",
+		"x keep b.jpg -> b.jpg",
+	}
+	if got := planString(m.items); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("\nexpected: %q\ngot:      %q", expected, got)
+	}
+}
@@ -0,0 +1,335 @@
+package ui
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// KeyMap holds every key binding, matched in Update and listed in the help.
+type KeyMap struct {
+	quit, forceQuit, help             key.Binding
+	up, down, pageUp, pageDown        key.Binding
+	collapse, expand, diff, preview   key.Binding
+	prompt, plan, confirm, cancel     key.Binding
+	apply, decline, reject, edit      key.Binding
+	complete, filter, stripRenames    key.Binding
+	mark, visual, markDirectory       key.Binding
+	markAction, markFolder, markShown key.Binding
+	prevPlan, nextPlan                key.Binding
+	retry, details, export            key.Binding
+}
+
+// bindings returns the bindings by the name the config file uses for them,
+// in the order they are listed.
+func (k *KeyMap) bindings() []namedBinding {
+	return []namedBinding{
+		{"quit", &k.quit, "quit"},
+		{"force-quit", &k.forceQuit, "quit"},
+		{"help", &k.help, "help"},
+		{"up", &k.up, "up"},
+		{"down", &k.down, "down"},
+		{"page-up", &k.pageUp, "prev page"},
+		{"page-down", &k.pageDown, "next page"},
+		{"collapse", &k.collapse, "collapse directory"},
+		{"expand", &k.expand, "expand directory"},
+		{"diff", &k.diff, "before/after view"},
+		{"preview", &k.preview, "preview"},
+		{"prompt", &k.prompt, "write a prompt"},
+		{"plan", &k.plan, "plan"},
+		{"confirm", &k.confirm, "confirm"},
+		{"cancel", &k.cancel, "cancel"},
+		{"apply", &k.apply, "apply changes"},
+		{"decline", &k.decline, "leave links"},
+		{"reject", &k.reject, "reject"},
+		{"edit", &k.edit, "change destination"},
+		{"complete", &k.complete, "complete directory"},
+		{"filter", &k.filter, "filter"},
+		{"strip-renames", &k.stripRenames, "keep names"},
+		{"mark", &k.mark, "mark"},
+		{"visual", &k.visual, "mark a range"},
+		{"mark-directory", &k.markDirectory, "mark directory"},
+		{"mark-action", &k.markAction, "mark same action"},
+		{"mark-folder", &k.markFolder, "mark same folder"},
+		{"mark-shown", &k.markShown, "mark all shown"},
+		{"prev-plan", &k.prevPlan, "previous plan"},
+		{"next-plan", &k.nextPlan, "next plan"},
+		{"retry", &k.retry, "retry"},
+		{"details", &k.details, "details"},
+		{"export", &k.export, "export report"},
+	}
+}
+
+type namedBinding struct {
+	name    string
+	binding *key.Binding
+	desc    string
+}
+
+// defaultKeys are the keys bound unless the config file says otherwise.
+var defaultKeys = map[string][]string{
+	"quit":           {"q", "ctrl+c"},
+	"force-quit":     {"ctrl+c"},
+	"help":           {"?"},
+	"up":             {"up", "k"},
+	"down":           {"down", "j"},
+	"page-up":        {"pgup", "b", "u"},
+	"page-down":      {"pgdown", "f", "d"},
+	"collapse":       {"left", "h"},
+	"expand":         {"right", "l"},
+	"diff":           {"v"},
+	"preview":        {"i"},
+	"prompt":         {"p"},
+	"plan":           {"enter"},
+	"confirm":        {"enter"},
+	"cancel":         {"esc"},
+	"apply":          {"y"},
+	"decline":        {"n"},
+	"reject":         {" "},
+	"edit":           {"e"},
+	"complete":       {"tab"},
+	"filter":         {"/"},
+	"strip-renames":  {"r"},
+	"mark":           {"m"},
+	"visual":         {"V"},
+	"mark-directory": {"A"},
+	"mark-action":    {"a"},
+	"mark-folder":    {"D"},
+	"mark-shown":     {"M"},
+	"prev-plan":      {"["},
+	"next-plan":      {"]"},
+	"retry":          {"r"},
+	"details":        {"enter"},
+	"export":         {"x"},
+}
+
+// keyScopes tell where bindings are matched, bindings of different scopes
+// may share keys. Global ones are matched everywhere, the others over the
+// plan.
+var keyScopes = map[string]string{
+	"quit": "global", "force-quit": "global", "help": "global", "cancel": "global",
+	"up": "global", "down": "global", "page-up": "global", "page-down": "global",
+	"confirm": "input", "complete": "input",
+	"retry": "report", "details": "report", "export": "report",
+}
+
+// DefaultKeyMap returns the keys Norbot is used with out of the box.
+func DefaultKeyMap() KeyMap {
+	var k KeyMap
+	for _, b := range k.bindings() {
+		*b.binding = key.NewBinding(key.WithKeys(defaultKeys[b.name]...), key.WithHelp("", b.desc))
+	}
+	return k
+}
+
+// ParseKeyMap binds the keys in overrides, by binding name, instead of the
+// default ones. Keys are named as bubbletea names them, "space" included. A
+// key bound twice in the same scope is an error.
+func ParseKeyMap(overrides map[string][]string) (KeyMap, error) {
+	k := DefaultKeyMap()
+	bindings := make(map[string]*key.Binding)
+	var names []string
+	for _, b := range k.bindings() {
+		bindings[b.name] = b.binding
+		names = append(names, b.name)
+	}
+	for name, keys := range overrides {
+		b, ok := bindings[name]
+		if !ok {
+			return k, fmt.Errorf("unknown key binding %q, expected one of: %s", name, strings.Join(names, ", "))
+		}
+		if len(keys) == 0 {
+			return k, fmt.Errorf("no keys given for %s", name)
+		}
+		keys = slices.Clone(keys)
+		for i, s := range keys {
+			if s == "space" {
+				keys[i] = " "
+			}
+		}
+		b.SetKeys(keys...)
+	}
+	return k, k.checkClashes()
+}
+
+// checkClashes returns an error for the first key bound to two bindings
+// matched in the same place.
+func (k *KeyMap) checkClashes() error {
+	bound := make(map[string][]string)
+	for _, b := range k.bindings() {
+		for _, s := range b.binding.Keys() {
+			for _, other := range bound[s] {
+				if clash(other, b.name) {
+					return fmt.Errorf("key %q is bound to both %s and %s", keyLabel(s), other, b.name)
+				}
+			}
+			bound[s] = append(bound[s], b.name)
+		}
+	}
+	return nil
+}
+
+func clash(a, b string) bool {
+	if a == "quit" && b == "force-quit" {
+		// Both quit, force quit also while typing.
+		return false
+	}
+	scopeA, scopeB := cmp.Or(keyScopes[a], "plan"), cmp.Or(keyScopes[b], "plan")
+	return scopeA == scopeB || scopeA == "global" || scopeB == "global"
+}
+
+// labelled sets the key shown in the help of every binding from its first
+// keys, so it follows remapping and the icons.
+func (k KeyMap) labelled() KeyMap {
+	for _, b := range k.bindings() {
+		keys := b.binding.Keys()
+		var label []string
+		for _, s := range keys[:min(len(keys), 2)] {
+			label = append(label, keyLabel(s))
+		}
+		b.binding.SetHelp(strings.Join(label, "/"), b.binding.Help().Desc)
+	}
+	return k
+}
+
+func keyLabel(s string) string {
+	switch s {
+	case " ":
+		return "space"
+	case "up":
+		return icons.up
+	case "down":
+		return icons.down
+	case "left":
+		return icons.left
+	case "right":
+		return icons.right
+	case "pgdown":
+		return "pgdn"
+	}
+	return s
+}
+
+// as returns b described as desc, for a binding meaning different things
+// depending on the status.
+func as(b key.Binding, desc string) key.Binding {
+	b.SetHelp(b.Help().Key, desc)
+	return b
+}
+
+// keyHelp lists the bindings for the help, the short help being the first
+// of the groups.
+type keyHelp [][]key.Binding
+
+func (h keyHelp) ShortHelp() []key.Binding {
+	if len(h) == 0 {
+		return nil
+	}
+	return h[0]
+}
+
+func (h keyHelp) FullHelp() [][]key.Binding {
+	return h
+}
+
+// keyHelp returns the bindings that do something in the current status,
+// grouped, the most useful first.
+func (m model) keyHelp() keyHelp {
+	k := m.keys
+	navigation := []key.Binding{k.up, k.down, k.pageUp, k.pageDown, k.collapse, k.expand}
+	view := []key.Binding{k.diff, k.preview, k.help, k.quit}
+
+	switch m.status {
+	case Started:
+		return keyHelp{
+			{k.prompt, as(k.plan, "plan"), k.diff, k.help, k.quit},
+			navigation,
+			view,
+		}
+	case Input:
+		return keyHelp{{as(k.confirm, "send"), as(k.cancel, "back"), k.forceQuit}}
+	case Waiting:
+		return keyHelp{
+			{as(k.cancel, "cancel query"), k.help, k.quit},
+			navigation,
+			view,
+		}
+	case Ready:
+		return keyHelp{
+			{k.reject, k.edit, k.apply, k.mark, k.filter, k.help, k.quit},
+			{k.apply, k.reject, k.edit, k.stripRenames, k.prompt, as(k.plan, "plan again"), k.prevPlan, k.nextPlan},
+			{k.mark, k.visual, k.markDirectory, k.markAction, k.markFolder, k.markShown, k.filter, as(k.cancel, "clear marks, then filter")},
+			navigation,
+			view,
+		}
+	case Editing:
+		return keyHelp{{k.complete, as(k.confirm, "save"), k.cancel, k.forceQuit}}
+	case Filtering:
+		return keyHelp{{as(k.confirm, "keep filter"), as(k.cancel, "clear filter"), k.forceQuit}}
+	case Reviewing:
+		return keyHelp{
+			{as(k.apply, "update links"), k.decline, as(k.reject, "skip link"), k.help, k.quit},
+			{k.up, k.down, k.pageUp, k.pageDown},
+		}
+	case Error:
+		var short []key.Binding
+		if m.failure != nil && m.failure.retry != nil {
+			short = append(short, k.retry)
+		}
+		short = append(short, as(k.cancel, "back"), k.details)
+		if m.failure != nil && m.failure.report != nil {
+			short = append(short, k.export)
+		}
+		short = append(short, k.help, k.quit)
+		if m.details || m.failure != nil && m.failure.report != nil {
+			return keyHelp{short, {as(k.up, "scroll up"), as(k.down, "scroll down"), k.pageUp, k.pageDown}}
+		}
+		return keyHelp{short}
+	case Finished:
+		if m.report != nil {
+			return keyHelp{
+				{k.export, as(k.up, "scroll up"), as(k.down, "scroll down"), k.help, k.quit},
+				{k.pageUp, k.pageDown},
+			}
+		}
+	}
+	return keyHelp{{k.help, k.quit}}
+}
+
+// helpView draws the help line under the list.
+func (m model) helpView() string {
+	return helpStyle.Render(m.help.ShortHelpView(m.keyHelp().ShortHelp()))
+}
+
+// fullHelpView draws the help screen, all the bindings of the status.
+func (m model) fullHelpView() string {
+	title := paneTitleStyle.Render("Keys")
+	body := lipgloss.NewStyle().PaddingLeft(4).PaddingTop(1).Render(m.help.FullHelpView(m.keyHelp().FullHelp()))
+	return lipgloss.JoinVertical(lipgloss.Left, title, body, helpStyle.Render("Press any key to close."))
+}
+
+// newHelp makes the help model, in ASCII if asked for.
+func newHelp(ascii bool) help.Model {
+	h := help.New()
+	if ascii {
+		h.ShortSeparator = " - "
+		h.Ellipsis = "..."
+	}
+	return h
+}
+
+// updateHelp closes the help screen on any key, quit included, but force
+// quit.
+func (m model) updateHelp(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if key.Matches(msg, m.keys.forceQuit) {
+		return m, tea.Quit
+	}
+	m.showHelp = false
+	return m, nil
+}
@@ -0,0 +1,140 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/atlomak/norbot/internal/fsutils"
+	"github.com/atlomak/norbot/internal/llm"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+func TestParseKeyMap(t *testing.T) {
+	keys, err := ParseKeyMap(map[string][]string{"reject": {"x", "space"}, "apply": {"ctrl+y"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(keys.reject.Keys(), ","); got != "x, " {
+		t.Errorf("expected reject on x and space, got %q", got)
+	}
+	if got := keys.labelled().reject.Help().Key; got != "x/space" {
+		t.Errorf("expected the help to name x/space, got %q", got)
+	}
+	if got := strings.Join(keys.apply.Keys(), ","); got != "ctrl+y" {
+		t.Errorf("expected apply on ctrl+y, got %q", got)
+	}
+	if got := strings.Join(keys.quit.Keys(), ","); got != "q,ctrl+c" {
+		t.Errorf("expected quit left alone, got %q", got)
+	}
+
+	if _, err := ParseKeyMap(map[string][]string{"teleport": {"t"}}); err == nil {
+		t.Error("expected an unknown binding to fail")
+	}
+	if _, err := ParseKeyMap(map[string][]string{"apply": {}}); err == nil {
+		t.Error("expected a binding without keys to fail")
+	}
+	if _, err := ParseKeyMap(map[string][]string{"edit": {"a"}}); err == nil || !strings.Contains(err.Error(), "edit and mark-action") {
+		t.Errorf("expected a clash with mark-action, got %v", err)
+	}
+	if _, err := ParseKeyMap(map[string][]string{"retry": {"R"}, "strip-renames": {"R"}}); err != nil {
+		t.Errorf("expected retry and strip-renames to share a key: %v", err)
+	}
+}
+
+func TestRemappedKeys(t *testing.T) {
+	keys, err := ParseKeyMap(map[string][]string{"reject": {"x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fsutils.NewMemFS()
+	if err := fsys.WriteFile("a.txt", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := InitModel(nil, fsys, Options{Keys: &keys})
+	files, err := fsutils.ReadDir(fsys, ".", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.setItems(files)
+	m.updateResults([]llm.Action{{Type: "move", Name: "a.txt", Result: "notes/a.txt"}})
+	m.status = Ready
+	for m.list.Index() < len(m.list.Items())-1 {
+		m.list.CursorDown()
+	}
+
+	next, _ := m.Update(tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}})
+	if m = next.(model); m.items[len(m.items)-1].rejected {
+		t.Fatal("expected space to do nothing once remapped")
+	}
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'x'}})
+	if m = next.(model); !m.items[len(m.items)-1].rejected {
+		t.Fatalf("expected x to reject the item, got %q", planString(m.items))
+	}
+	if view := ansi.Strip(m.View()); !strings.Contains(view, "Press x to reject") {
+		t.Errorf("expected the hint to follow the remapping:\n%s", view)
+	}
+}
+
+func TestKeyHelp(t *testing.T) {
+	m, _ := testModel(t, "a.txt")
+	next, _ := m.Update(tea.WindowSizeMsg{Width: 120, Height: 40})
+	m = next.(model)
+
+	// The help line follows the status.
+	if help := ansi.Strip(m.helpView()); !strings.Contains(help, "p write a prompt") || strings.Contains(help, "apply") {
+		t.Errorf("expected the help before planning, got %q", help)
+	}
+	m.updateResults([]llm.Action{{Type: "move", Name: "a.txt", Result: "notes/a.txt"}})
+	m.status = Ready
+	if help := ansi.Strip(m.helpView()); !strings.Contains(help, "y apply changes") {
+		t.Errorf("expected the help of a plan, got %q", help)
+	}
+
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'?'}})
+	m = next.(model)
+	view := ansi.Strip(m.View())
+	for _, expected := range []string{"Keys", "mark same folder", "previous plan", "next page"} {
+		if !strings.Contains(view, expected) {
+			t.Errorf("expected %q on the help screen:\n%s", expected, view)
+		}
+	}
+
+	// Any key closes the help, without doing what it is bound to.
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}})
+	if m = next.(model); m.showHelp || m.status != Ready {
+		t.Errorf("expected the help closed and the plan left alone, got status %d", m.status)
+	}
+	m.showHelp = true
+	next, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'q'}})
+	if next.(model).showHelp || cmd != nil {
+		t.Error("expected q to close the help, not to quit")
+	}
+	if _, cmd := m.Update(tea.KeyMsg{Type: tea.KeyCtrlC}); cmd == nil || cmd() != tea.Quit() {
+		t.Error("expected ctrl+c to quit from the help")
+	}
+}
+
+func TestForceQuit(t *testing.T) {
+	keys, err := ParseKeyMap(map[string][]string{"force-quit": {"ctrl+q"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fsutils.NewMemFS()
+	m := InitModel(nil, fsys, Options{Keys: &keys})
+	m.textInput.Focus()
+	m.editInput.Focus()
+	m.filterInput.Focus()
+
+	for _, status := range []status{Input, Editing, Filtering} {
+		m.status = status
+		next, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'q'}})
+		typed := next.(model).textInput.Value() + next.(model).editInput.Value() + next.(model).filterInput.Value()
+		if next.(model).status != status || typed != "q" {
+			t.Errorf("expected q to be typed in status %d, got %q", status, typed)
+		}
+		if _, cmd := m.Update(tea.KeyMsg{Type: tea.KeyCtrlQ}); cmd == nil || cmd() != tea.Quit() {
+			t.Errorf("expected the remapped force quit to quit in status %d", status)
+		}
+	}
+}
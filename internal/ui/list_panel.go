@@ -5,81 +5,187 @@ import (
 	"io"
 	"strings"
 
-	"github.com/charmbracelet/bubbles/key"
+	"github.com/atlomak/norbot/internal/fsutils"
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/rivo/uniseg"
 )
 
 const (
-	dirIcon        = "\U0001F4C1"
-	fileIcon       = "\U0001F4C4"
-	newFile        = "\U00002728"
-	colWidthName   = 40
-	colWidthAction = 10
+	colWidthAction = 8
+	// narrowWidth is the list width below which the current location
+	// column is left out, the proposed tree needs the room more.
+	narrowWidth = 70
+	// rowIndent is taken by the padding, the cursor and the state marker in
+	// front of a row.
+	rowIndent = 4
+	// helpHeight is taken by the help line under the list.
+	helpHeight = 2
 )
 
 var (
 	titleStyle        = lipgloss.NewStyle().MarginLeft(2)
-	itemStyle         = lipgloss.NewStyle().PaddingLeft(4)
-	selectedItemStyle = lipgloss.NewStyle().PaddingLeft(2).Foreground(lipgloss.Color(gnomeGreen))
-	rejectedItemStyle = lipgloss.NewStyle().PaddingLeft(2).Foreground(lipgloss.Color("#FF6347"))
+	itemStyle         = lipgloss.NewStyle().PaddingLeft(1)
+	selectedItemStyle = lipgloss.NewStyle().PaddingLeft(1).Bold(true)
+	rejectedItemStyle = lipgloss.NewStyle().PaddingLeft(1).Strikethrough(true)
+	resolvedItemStyle = lipgloss.NewStyle().PaddingLeft(1)
+	markedItemStyle   = lipgloss.NewStyle().PaddingLeft(1)
 	paginationStyle   = list.DefaultStyles().PaginationStyle.PaddingLeft(4)
 	helpStyle         = list.DefaultStyles().HelpStyle.PaddingLeft(4).PaddingBottom(1)
 )
 
 type item struct {
-	rejected bool
-	name     string
-	action   string
-	result   string
+	rejected  bool
+	immovable bool
+	name      string
+	action    string
+	result    string
+	// conflict holds the destination suggested by Norbot when it had to be
+	// changed to resolve a collision.
+	conflict string
+	// revised holds the destination before the last revision of the plan
+	// changed it.
+	revised string
 }
 
 func (i item) FilterValue() string { return "" }
 
+// linkItem is a link Norbot proposes to update after moving files.
+type linkItem struct {
+	edit     fsutils.LinkEdit
+	rejected bool
+}
+
+func (i linkItem) FilterValue() string { return "" }
+
 type itemDelegate struct{}
 
 func (d itemDelegate) Height() int                             { return 1 }
 func (d itemDelegate) Spacing() int                            { return 0 }
 func (d itemDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
 func (d itemDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
-	i, ok := listItem.(item)
+	if l, ok := listItem.(linkItem); ok {
+		renderLinkItem(w, m, index, l)
+		return
+	}
+	row, ok := listItem.(treeRow)
 	if !ok {
 		return
 	}
+	i := row.item
+
+	cols := listColumns(m.Width())
+	var note string
+	if i.conflict != "" {
+		note = fmt.Sprintf("  (resolved: %s taken)", i.conflict)
+	} else if i.immovable {
+		note = "  (special file, kept in place)"
+	} else if i.revised != "" {
+		note = fmt.Sprintf("  (was: %s)", i.revised)
+	}
 
-	var str string
-	name := i.name
-	if name == "" {
-		str = fmt.Sprintf("%-*s %-*s %s", colWidthName+15, newFile, colWidthAction, i.action, renderItem(i.result))
-	} else {
-		if len(name) > colWidthName {
-			name = trimName(name)
+	var current, action string
+	if row.node.item >= 0 {
+		action = i.action
+		current = icons.created
+		if i.name != "" {
+			current = renderItem(i.name, cols.name)
 		}
-		str = fmt.Sprintf("%-*s %-*s %s", colWidthName+15, renderItem(name), colWidthAction, i.action, renderItem(i.result))
 	}
+	str := fmt.Sprintf("%s %s ", fit(action, cols.action), renderNode(row, cols.node))
+	if cols.name > 0 {
+		str = fit(current, cols.name) + " " + str
+	}
+	str = ansi.Truncate(strings.TrimRight(str, " ")+note, cols.total, icons.ellipsis)
+
+	// The state is marked by a sign as well as a color, the cursor apart
+	// from both.
+	state, style := " ", itemStyle
+	switch {
+	case row.marked:
+		state, style = "*", markedItemStyle
+	case i.rejected:
+		state, style = "x", rejectedItemStyle
+	case i.conflict != "":
+		state, style = "!", resolvedItemStyle
+	}
+	fmt.Fprint(w, renderRow(m, index, state, style, str))
+}
 
-	fn := itemStyle.Render
+// renderRow draws a row behind the cursor, if selected, and its state.
+func renderRow(m list.Model, index int, state string, style lipgloss.Style, str string) string {
+	cursor := " "
 	if index == m.Index() {
-		fn = func(s ...string) string {
-			return selectedItemStyle.Render("> " + strings.Join(s, " "))
-		}
-	} else if i.rejected {
-		fn = func(s ...string) string {
-			return rejectedItemStyle.Render("x " + strings.Join(s, " "))
+		cursor = ">"
+		style = style.Inherit(selectedItemStyle)
+		if state == " " {
+			style = selectedItemStyle
 		}
 	}
+	return style.Render(cursor + state + " " + str)
+}
+
+func renderLinkItem(w io.Writer, m list.Model, index int, i linkItem) {
+	cols := listColumns(m.Width())
+	location := fmt.Sprintf("%s:%d", i.edit.File, i.edit.Line)
+	width := max(cols.name, cols.total*2/5)
+	str := fit(location, width) + " " + truncateMiddle(fmt.Sprintf("%s -> %s", i.edit.Old, i.edit.New), cols.total-width-1)
+
+	state, style := " ", itemStyle
+	if i.rejected {
+		state, style = "x", rejectedItemStyle
+	}
+	fmt.Fprint(w, renderRow(m, index, state, style, str))
+}
 
-	fmt.Fprint(w, fn(str))
+// columns are the widths, in terminal cells, of the parts of a row.
+type columns struct {
+	total, name, action, node int
 }
 
-func trimName(name string) string {
-	r := []rune(name)
-	trunc := r[:colWidthName-4]
-	return string(trunc) + "..."
+// listColumns splits a list width between the current location, the action
+// and the proposed tree, leaving out the location when there is no room.
+func listColumns(width int) columns {
+	c := columns{total: max(width-rowIndent, 20), action: colWidthAction}
+	if c.total < narrowWidth {
+		c.node = c.total - c.action - 1
+		return c
+	}
+	c.name = (c.total - c.action - 2) * 2 / 5
+	c.node = c.total - c.name - c.action - 2
+	return c
+}
+
+// renderNode draws a node of the proposed tree in width cells. Directories
+// show whether they are collapsed and what happens to the files inside,
+// as long as the name has room.
+func renderNode(row treeRow, width int) string {
+	if !row.node.isDir() {
+		start := fmt.Sprintf("%s%s ", row.prefix, icons.file)
+		return start + truncateMiddle(row.node.name, width-uniseg.StringWidth(start))
+	}
+
+	marker := icons.expanded
+	if row.collapsed {
+		marker = icons.collapsed
+	}
+	start := fmt.Sprintf("%s%s %s ", row.prefix, marker, icons.dir)
+	counts := fmt.Sprintf(" (%d files)", row.node.kept)
+	if row.node.moved > 0 {
+		counts = fmt.Sprintf(" (%d moved, %d kept)", row.node.moved, row.node.kept)
+	}
+	room := width - uniseg.StringWidth(start)
+	if room-uniseg.StringWidth(counts) < min(uniseg.StringWidth(row.node.name), 10) {
+		return start + truncateMiddle(row.node.name, room)
+	}
+	return start + truncateMiddle(row.node.name, room-uniseg.StringWidth(counts)) + counts
 }
 
-func renderItem(file string) string {
+// renderItem draws the current location of a file, indented by its depth,
+// in width cells.
+func renderItem(file string, width int) string {
 	if file == "" {
 		return file
 	}
@@ -93,40 +199,25 @@ func renderItem(file string) string {
 	parents := len(path) - 1
 
 	if parents == 1 {
-		b.WriteString("└─")
+		b.WriteString(icons.lastBranch)
 	} else if parents > 1 {
 		for i := 0; i < parents-1; i++ {
-			b.WriteString("│ ")
+			b.WriteString(icons.pipe)
 		}
-		b.WriteString("└─")
+		b.WriteString(icons.lastBranch)
 	}
 
+	icon := icons.file
 	if isDir {
-		b.WriteString(fmt.Sprintf("%s %s", dirIcon, file))
-		return b.String()
-	}
-	b.WriteString(fmt.Sprintf("%s %s", fileIcon, file))
-	return b.String()
-}
-
-func newKeyMap() []key.Binding {
-	return []key.Binding{
-		key.NewBinding(
-			key.WithKeys("p"),
-			key.WithHelp("p", "Write prompt to Norbot"),
-		),
-		key.NewBinding(
-			key.WithKeys("enter"),
-			key.WithHelp("enter", "Let the Norbot think..."),
-		),
-		key.NewBinding(
-			key.WithKeys("space"),
-			key.WithHelp("space", "Reject file modification"),
-		),
+		icon = icons.dir
 	}
+	b.WriteString(icon + " ")
+	return b.String() + truncateMiddle(file, width-uniseg.StringWidth(b.String()))
 }
 
-func initList() list.Model {
+// initList makes the list, moved with keys. The help is drawn apart from
+// the list, to follow the status.
+func initList(keys KeyMap) list.Model {
 	items := []list.Item{}
 
 	const defaultWidth = 120
@@ -137,11 +228,19 @@ func initList() list.Model {
 	l.SetShowTitle(false)
 	l.SetShowStatusBar(false)
 	l.SetFilteringEnabled(false)
-	l.SetShowHelp(true)
+	l.SetShowHelp(false)
 	l.Styles.Title = titleStyle
 	l.Styles.PaginationStyle = paginationStyle
-	l.Styles.HelpStyle = helpStyle
-	l.AdditionalFullHelpKeys = newKeyMap
+	l.KeyMap.CursorUp = keys.up
+	l.KeyMap.CursorDown = keys.down
+	// Left and right fold the tree, pages are turned with the other keys.
+	l.KeyMap.PrevPage = keys.pageUp
+	l.KeyMap.NextPage = keys.pageDown
+	// Quitting and help are up to the model.
+	l.KeyMap.Quit.SetEnabled(false)
+	l.KeyMap.ForceQuit.SetEnabled(false)
+	l.KeyMap.ShowFullHelp.SetEnabled(false)
+	l.KeyMap.CloseFullHelp.SetEnabled(false)
 
 	return l
 }
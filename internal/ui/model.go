@@ -2,10 +2,13 @@ package ui
 
 import (
 	"log"
+	"strings"
 
 	"github.com/atlomak/norbot/internal/fsutils"
 	"github.com/atlomak/norbot/internal/llm"
 	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -13,17 +16,105 @@ import (
 	"github.com/charmbracelet/lipgloss"
 )
 
+// Options configure how Norbot plans and applies changes.
+type Options struct {
+	Conflicts      ConflictStrategy
+	FollowSymlinks bool
+	// UpdateLinks rewrites relative links broken by the applied moves,
+	// after a review.
+	UpdateLinks bool
+	// Journal is the file applied changes are recorded in.
+	Journal string
+	// ReportDir is where reports are exported without a journal to put
+	// them next to, the temporary directory if empty.
+	ReportDir string
+	// Theme colors the interface, the default one if left empty. NoColor
+	// turns colors off and ASCII draws icons and trees without emoji and
+	// box drawing characters.
+	Theme   Theme
+	NoColor bool
+	ASCII   bool
+	// Keys are the key bindings, DefaultKeyMap if nil.
+	Keys *KeyMap
+	// Log holds what was logged, shown with the details of an error.
+	Log *LogBuffer
+}
+
 type model struct {
-	list        list.Model
+	list list.Model
+	// items are the plan per file and directory, the list shows them as a tree.
+	items     []item
+	collapsed map[string]bool
+	split     bool
+	// preview shows the preview pane, with previews loaded by name and
+	// loading the one on its way.
+	preview  bool
+	previews map[string]previewMsg
+	loading  string
+	width    int
+	height   int
+	// selected holds the marked items by itemKey, visual the start of a
+	// range selection at row anchor.
+	selected map[string]bool
+	visual   bool
+	anchor   int
+	// filter is the query limiting the items shown, see parseFilter.
+	filter      string
+	filterInput textinput.Model
+	diffOffset  int
+	fsys        fsutils.FS
 	files       fsutils.FileList
-	actions     map[string]llm.Action
-	llm         *llm.GeminiModel
-	maxDepth    int
-	textInput   textinput.Model
+	// plan holds the actions as suggested, resolved and edited.
+	plan     []llm.Action
+	actions  map[string]llm.Action
+	resolved map[string]string
+	warnings []string
+	options  Options
+	llm      *llm.GeminiModel
+	// chat is the conversation the plan came from, revision counts the
+	// follow-up prompts and changes lists what the last one changed.
+	chat     *llm.Chat
+	revision int
+	changes  []planChange
+	// previous is the plan the last revision started from.
+	previous []llm.Action
+	// candidates are the plans to choose from, candidate the one shown.
+	candidates []llm.Plan
+	candidate  int
+	maxDepth   int
+	scanning   bool
+	scanned    int
+	textInput  textinput.Model
+	editInput  textinput.Model
+	// editing is the name of the item whose destination is being edited.
+	editing     string
+	completions []string
+	editErr     error
 	progress    progress.Model
-	progessDone bool
-	status      status
-	err         error
+	// stream is the query running, streamed the actions it received so
+	// far per candidate.
+	stream   *planStream
+	streamed map[int][]llm.Action
+	// reviewed is the plan under review, rejections included, while a new
+	// query streams over it.
+	reviewed []item
+	status   status
+	// failure is the error shown while the status is Error, details shows
+	// its details pane scrolled down by detailsOffset lines.
+	failure       *failure
+	details       bool
+	detailsOffset int
+	// report tells how the last apply went, scrolled down by reportOffset
+	// lines. exported lists where it was written to, or exportErr why not.
+	report       *applyReport
+	reportOffset int
+	exported     []string
+	exportErr    error
+	// keys are matched against key presses, help lists them under the list
+	// and, all of them, on the help screen while showHelp is set.
+	keys     KeyMap
+	help     help.Model
+	showHelp bool
 }
 
 type status int
@@ -33,100 +124,287 @@ const (
 	Input
 	Waiting
 	Ready
+	Editing
+	Filtering
+	Reviewing
 	Finished
 	Error
 )
 
 func (m model) Init() tea.Cmd {
-	return tea.Batch(readDir(".", 0), textinput.Blink)
+	return tea.Batch(readDir(m.fsys, ".", m.scanOptions(0)), textinput.Blink)
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
-		m.list.SetHeight(msg.Height - statusPanelStyle.GetHeight())
-		m.list.SetWidth(msg.Width)
+		m.width, m.height = msg.Width, msg.Height
+		m.layout()
 		return m, nil
+	case previewDueMsg:
+		if msg.name != m.previewName() || msg.name == m.loading {
+			return m, nil
+		}
+		if _, ok := m.previews[msg.name]; ok {
+			return m, nil
+		}
+		m.loading = msg.name
+		return m, loadPreview(m.fsys, msg.name)
+	case previewMsg:
+		m.previews[msg.name] = msg
+		if m.loading == msg.name {
+			m.loading = ""
+		}
+		return m, m.requestPreview()
+	case scanProgressMsg:
+		m.scanned += msg.found
+		return m, msg.scan.wait
 	case readDirMsg:
+		m.scanning = false
 		if msg.err != nil {
 			m.handleError(msg.err, msg)
 			return m, nil
 		}
 		return m, m.setItems(msg.files)
 	case queryResultMsg:
+		if msg.stream != m.stream {
+			return m, nil
+		}
+		m.stream = nil
 		if msg.err != nil {
 			m.handleError(msg.err, msg)
 			return m, nil
 		}
-		m.progessDone = true
-		updateResults := m.updateResults(msg.actions)
-		return m, tea.Batch(updateResults, m.sortItems)
+		m.status = Ready
+		m.reviewed = nil
+		m.chat = msg.stream.chat
+		m.candidates, m.candidate = msg.plans, 0
+		if msg.revised {
+			return m, tea.Batch(m.progress.SetPercent(1), m.reviseResults(msg.plans[0].Actions))
+		}
+		m.revision = 0
+		return m, tea.Batch(m.progress.SetPercent(1), m.updateResults(msg.plans[0].Actions))
+	case streamProgressMsg:
+		if msg.stream != m.stream {
+			// Cancelled, the query winds down on its own.
+			return m, nil
+		}
+		return m, tea.Batch(m.receive(msg.received), msg.stream.wait)
 	case applyChangesMsg:
+		if msg.report != nil {
+			m.report, m.reportOffset = msg.report, 0
+			m.exported, m.exportErr = nil, nil
+		}
 		if msg.err != nil {
 			m.handleError(msg.err, msg)
 			return m, nil
 		}
-		return m, readDir(".", m.maxDepth)
-	case tickMsg:
-		if m.progessDone && m.progress.Percent() < 1.0 {
-			cmd := m.progress.SetPercent(1.0)
-			return m, tea.Sequence(cmd, tickCmd())
-		} else if m.progessDone {
-			m.status = Ready
+		if m.options.UpdateLinks && len(msg.moves) > 0 {
+			return m, findLinkEdits(m.fsys, msg.moves)
+		}
+		return m, m.rescan()
+	case linkEditsMsg:
+		if msg.err != nil {
+			m.handleError(msg.err, msg)
 			return m, nil
 		}
-
-		if m.progress.Percent() < 0.95 {
-			cmd := m.progress.IncrPercent(0.03)
-			return m, tea.Sequence(cmd, tickCmd())
+		if len(msg.edits) == 0 {
+			return m, m.rescan()
 		}
-		return m, tickCmd()
+		m.status = Reviewing
+		m.layout()
+		return m, m.list.SetItems(editsToItems(msg.edits))
+	case reportExportedMsg:
+		m.exported, m.exportErr = msg.paths, msg.err
+		return m, nil
 	case progress.FrameMsg:
 		progressModel, cmd := m.progress.Update(msg)
 		m.progress = progressModel.(progress.Model)
 		return m, cmd
 	case tea.KeyMsg:
+		if m.showHelp {
+			return m.updateHelp(msg)
+		}
+		if m.status == Error {
+			return m.updateError(msg)
+		}
+		if m.status == Finished && m.report != nil {
+			if model, cmd, ok := m.updateReport(msg); ok {
+				return model, cmd
+			}
+		}
 		if m.status == Input {
-			switch keypress := msg.String(); keypress {
-			case "q", "ctrl+c":
+			switch {
+			case key.Matches(msg, m.keys.forceQuit):
 				return m, tea.Quit
-			case "enter":
-				if m.status == Finished {
-					return m, tea.Quit
+			case key.Matches(msg, m.keys.confirm):
+				if m.scanning {
+					return m, nil
 				}
-				m.progessDone = false
 				m.status = Waiting
 				m.textInput.Blur()
+				if prompt := m.textInput.Value(); m.chat != nil && m.plan != nil && strings.TrimSpace(prompt) != "" {
+					// A follow-up prompt revises the plan under review.
+					m.textInput.Reset()
+					return m, m.startRevision(prompt)
+				}
 				return m, m.startQuery(m.files, m.textInput.Value())
-			case tea.KeyEsc.String():
+			case key.Matches(msg, m.keys.cancel):
 				m.status = Started
 			}
 			var promptCmd tea.Cmd
 			m.textInput, promptCmd = m.textInput.Update(msg)
 			return m, promptCmd
 		}
-		switch keypress := msg.String(); keypress {
-		case "q", "ctrl+c":
+		if m.status == Editing {
+			return m.updateEdit(msg)
+		}
+		if m.status == Filtering {
+			return m.updateFilter(msg)
+		}
+		if m.split && m.status != Reviewing {
+			switch {
+			case key.Matches(msg, m.keys.up):
+				m.scrollDiff(-1)
+				return m, nil
+			case key.Matches(msg, m.keys.down):
+				m.scrollDiff(1)
+				return m, nil
+			case key.Matches(msg, m.keys.pageUp):
+				m.scrollDiff(-m.diffHeight())
+				return m, nil
+			case key.Matches(msg, m.keys.pageDown):
+				m.scrollDiff(m.diffHeight())
+				return m, nil
+			}
+		}
+		switch {
+		case key.Matches(msg, m.keys.quit):
 			return m, tea.Quit
-		case "enter":
+		case key.Matches(msg, m.keys.help):
+			m.showHelp = true
+			return m, nil
+		case key.Matches(msg, m.keys.diff):
+			m.split = !m.split
+			m.scrollDiff(0)
+			m.layout()
+			return m, m.requestPreview()
+		case key.Matches(msg, m.keys.preview):
+			if m.status == Reviewing {
+				return m, nil
+			}
+			return m, m.togglePreview()
+		case key.Matches(msg, m.keys.plan):
 			if m.status == Finished {
 				return m, tea.Quit
 			}
-			m.progessDone = false
+			if m.scanning || m.status == Reviewing || m.status == Waiting {
+				return m, nil
+			}
 			m.status = Waiting
 			return m, m.startQuery(m.files, "")
-		case "y":
+		case key.Matches(msg, m.keys.apply):
 			if m.status == Finished {
 				return m, tea.Quit
 			}
+			if m.status == Reviewing {
+				m.status = Finished
+				return m, m.applyLinkEdits
+			}
+			if m.status != Ready {
+				// A plan still streaming in is partial and its collisions
+				// are not resolved yet.
+				return m, nil
+			}
 			m.status = Finished
 			return m, m.applyChanges
-		case " ":
+		case key.Matches(msg, m.keys.decline):
+			if m.status != Reviewing {
+				return m, nil
+			}
+			m.status = Finished
+			return m, m.rescan()
+		case key.Matches(msg, m.keys.reject):
+			if m.status == Reviewing {
+				return m, m.toggleLinkItem
+			}
+			if m.status != Ready {
+				return m, nil
+			}
+			if len(m.selection()) > 0 {
+				return m, m.toggleSelection()
+			}
+			return m, m.toggleItem()
+		case key.Matches(msg, m.keys.filter):
+			if m.status != Ready || m.split {
+				return m, nil
+			}
+			return m, m.startFilter()
+		case key.Matches(msg, m.keys.cancel):
+			if m.status == Waiting {
+				return m, m.cancelQuery()
+			}
+			if m.status != Ready || m.split {
+				return m, nil
+			}
+			// Marks go first, then the filter.
+			if len(m.selection()) == 0 && m.filter != "" {
+				return m, m.setFilter("")
+			}
+			m.clearSelection()
+			return m, nil
+		case key.Matches(msg, m.keys.mark, m.keys.visual, m.keys.markDirectory, m.keys.markAction, m.keys.markFolder, m.keys.markShown):
+			if m.status != Ready || m.split {
+				return m, nil
+			}
+			switch {
+			case key.Matches(msg, m.keys.mark):
+				m.toggleMark()
+			case key.Matches(msg, m.keys.visual):
+				m.toggleVisual()
+			case key.Matches(msg, m.keys.markDirectory):
+				m.markDirectory()
+			case key.Matches(msg, m.keys.markAction):
+				m.markSameAction()
+			case key.Matches(msg, m.keys.markFolder):
+				m.markSameFolder()
+			case key.Matches(msg, m.keys.markShown):
+				m.markShown()
+			}
+			return m, nil
+		case key.Matches(msg, m.keys.stripRenames):
 			if m.status != Ready {
 				return m, nil
 			}
-			return m, tea.Sequence(m.toggleItem, m.sortItems)
-		case "p":
+			return m, m.stripRenames()
+		case key.Matches(msg, m.keys.prevPlan, m.keys.nextPlan):
+			if m.status != Ready || len(m.candidates) < 2 {
+				return m, nil
+			}
+			step := 1
+			if key.Matches(msg, m.keys.prevPlan) {
+				step = len(m.candidates) - 1
+			}
+			return m, m.showCandidate((m.candidate + step) % len(m.candidates))
+		case key.Matches(msg, m.keys.collapse):
+			if m.status == Reviewing {
+				return m, nil
+			}
+			return m, m.collapse()
+		case key.Matches(msg, m.keys.expand):
+			if m.status == Reviewing {
+				return m, nil
+			}
+			return m, m.expand()
+		case key.Matches(msg, m.keys.edit):
+			if m.status != Ready {
+				return m, nil
+			}
+			return m, m.startEdit()
+		case key.Matches(msg, m.keys.prompt):
+			if m.status == Reviewing || m.status == Waiting {
+				return m, nil
+			}
 			m.status = Input
 			m.textInput.Focus()
 			return m, nil
@@ -137,12 +415,35 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	m.textInput, promptCmd = m.textInput.Update(msg)
 	m.list, listCmd = m.list.Update(msg)
-	return m, tea.Batch(promptCmd, listCmd)
+	if m.visual {
+		m.markRows()
+	}
+	return m, tea.Batch(promptCmd, listCmd, m.requestPreview())
+}
+
+// layout sizes the list to the room left by the status panel and next to
+// the panes shown.
+func (m *model) layout() {
+	if m.width == 0 {
+		return
+	}
+	m.help.Width = m.width - helpStyle.GetHorizontalFrameSize()
+	m.list.SetHeight(max(m.height-m.panelHeight()-helpHeight, 1))
+	if m.previewing() {
+		m.list.SetWidth(m.width - previewWidth(m.width))
+		return
+	}
+	m.list.SetWidth(m.width)
 }
 
+func (m model) scanOptions(depth int) fsutils.ScanOptions {
+	return fsutils.ScanOptions{Depth: depth, FollowSymlinks: m.options.FollowSymlinks}
+}
+
+// handleError shows err until it is retried or left behind.
 func (m *model) handleError(err error, msg tea.Msg) {
+	m.failure = m.failureOf(err, msg)
 	m.status = Error
-	m.err = err
 	log.Printf("msg: %T returned error: %s", msg, err.Error())
 }
 
@@ -157,25 +458,65 @@ func (m model) View() string {
 		statusPanel = m.loadingPanelView()
 	case Ready:
 		statusPanel = m.readyPanelView()
+	case Editing:
+		statusPanel = m.editPanelView()
+	case Filtering:
+		statusPanel = m.filterPanelView()
+	case Reviewing:
+		statusPanel = m.reviewPanelView()
 	case Finished:
 		statusPanel = m.finishPanelView()
 	case Error:
 		statusPanel = m.errorPanelView()
-		return lipgloss.JoinVertical(lipgloss.Top, statusPanelStyle.Render(statusPanel), m.err.Error())
+		if !m.showHelp {
+			return lipgloss.JoinVertical(lipgloss.Top, m.panelStyle().Render(statusPanel), m.errorView())
+		}
+	}
+	if m.showHelp {
+		return lipgloss.JoinVertical(lipgloss.Top, m.panelStyle().Render(statusPanel), m.fullHelpView())
+	}
+	if m.status == Finished && m.report != nil {
+		return lipgloss.JoinVertical(lipgloss.Top, m.panelStyle().Render(statusPanel), m.reportView(), m.helpView())
 	}
-	s := lipgloss.JoinVertical(lipgloss.Top, statusPanelStyle.Render(statusPanel), m.list.View())
+	if m.split && m.status != Reviewing {
+		return lipgloss.JoinVertical(lipgloss.Top, m.panelStyle().Render(statusPanel), m.diffView(), m.helpView())
+	}
+	if m.previewing() {
+		listView := lipgloss.NewStyle().MaxWidth(m.list.Width()).Width(m.list.Width()).Render(m.list.View())
+		body := lipgloss.JoinHorizontal(lipgloss.Top, listView, m.previewView())
+		return lipgloss.JoinVertical(lipgloss.Top, m.panelStyle().Render(statusPanel), body, m.helpView())
+	}
+	s := lipgloss.JoinVertical(lipgloss.Top, m.panelStyle().Render(statusPanel), m.list.View(), m.helpView())
 	return s
 }
 
-func InitModel(llm *llm.GeminiModel) model {
+func InitModel(llm *llm.GeminiModel, fsys fsutils.FS, options Options) model {
 
-	progess := progress.New(progress.WithScaledGradient(darkGreen, gnomeGreen))
-	l := initList()
+	theme := options.Theme
+	if theme == (Theme{}) {
+		theme = Themes[DefaultTheme]
+	}
+	applyTheme(theme, options.NoColor, options.ASCII)
+	progess := newProgress(theme, options.NoColor, options.ASCII)
+	keys := DefaultKeyMap()
+	if options.Keys != nil {
+		keys = *options.Keys
+	}
+	keys = keys.labelled()
+	l := initList(keys)
+	if options.ASCII {
+		asciiList(&l)
+	}
 	textInput := textinput.New()
 	textInput.Cursor.SetMode(cursor.CursorBlink)
 	textInput.Prompt = " "
 	textInput.Placeholder = "Prompt Norbot..."
-	m := model{list: l, llm: llm, progress: progess, status: Started, textInput: textInput}
+	editInput := textinput.New()
+	editInput.Prompt = " "
+	filterInput := textinput.New()
+	filterInput.Prompt = " "
+	filterInput.Placeholder = "text, action:move, dir:Photos/, ext:pdf, rejected"
+	m := model{list: l, llm: llm, fsys: fsys, progress: progess, status: Started, textInput: textInput, editInput: editInput, filterInput: filterInput, options: options, keys: keys, help: newHelp(options.ASCII), scanning: true, collapsed: make(map[string]bool), selected: make(map[string]bool), previews: make(map[string]previewMsg)}
 
 	return m
 }
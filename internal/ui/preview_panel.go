@@ -0,0 +1,144 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/atlomak/norbot/internal/fsutils"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// previewDelay is how long the selection has to rest on an item before its
+// preview is loaded, so that scrolling through the list reads nothing.
+const previewDelay = 100 * time.Millisecond
+
+var (
+	previewStyle      = lipgloss.NewStyle().PaddingLeft(1).BorderStyle(lipgloss.NormalBorder()).BorderLeft(true)
+	previewTitleStyle = lipgloss.NewStyle().Bold(true)
+	previewLabelStyle = lipgloss.NewStyle().Width(10)
+)
+
+// previewMsg carries the preview of name, loaded in the background.
+type previewMsg struct {
+	name    string
+	preview fsutils.Preview
+	err     error
+}
+
+// previewDueMsg asks for the preview of name, if it is still selected.
+type previewDueMsg struct {
+	name string
+}
+
+func loadPreview(fsys fsutils.FS, name string) tea.Cmd {
+	return func() tea.Msg {
+		p, err := fsutils.ReadPreview(fsys, strings.TrimSuffix(name, "/"))
+		return previewMsg{name: name, preview: p, err: err}
+	}
+}
+
+// previewing reports whether the preview pane is on screen.
+func (m model) previewing() bool {
+	return m.preview && !m.split && m.status != Reviewing
+}
+
+// previewName returns the current path of the selected item, or "" for
+// rows with nothing on disk yet.
+func (m model) previewName() string {
+	row, ok := m.list.SelectedItem().(treeRow)
+	if !ok || row.node.item < 0 {
+		return ""
+	}
+	return row.item.name
+}
+
+// requestPreview schedules loading the preview of the selected item.
+func (m model) requestPreview() tea.Cmd {
+	name := m.previewName()
+	if !m.previewing() || name == "" || name == m.loading {
+		return nil
+	}
+	if _, ok := m.previews[name]; ok {
+		return nil
+	}
+	return tea.Tick(previewDelay, func(time.Time) tea.Msg {
+		return previewDueMsg{name: name}
+	})
+}
+
+func (m *model) togglePreview() tea.Cmd {
+	m.preview = !m.preview
+	m.layout()
+	return m.requestPreview()
+}
+
+// previewWidth is the width of the preview pane, out of the whole width.
+func previewWidth(width int) int {
+	return min(max(width*2/5, 30), 60)
+}
+
+func (m model) previewView() string {
+	width := previewWidth(m.width) - previewStyle.GetHorizontalFrameSize()
+	var lines []string
+	name := m.previewName()
+	msg, loaded := m.previews[name]
+	switch {
+	case name == "":
+		lines = append(lines, "New directory, created by the plan.")
+	case !loaded:
+		lines = append(lines, previewTitleStyle.Render(name), "", "Loading...")
+	case msg.err != nil:
+		lines = append(lines, previewTitleStyle.Render(name), "", warningStyle.UnsetMarginLeft().Render("! "+msg.err.Error()))
+	default:
+		lines = previewLines(msg.preview)
+	}
+
+	content := lipgloss.NewStyle().Width(width).MaxWidth(width).MaxHeight(m.list.Height()).Render(strings.Join(lines, "\n"))
+	return previewStyle.Height(m.list.Height()).Render(content)
+}
+
+func previewLines(p fsutils.Preview) []string {
+	field := func(label, value string) string {
+		return previewLabelStyle.Render(label) + value
+	}
+
+	lines := []string{previewTitleStyle.Render(p.Name), ""}
+	if !p.Mode.IsDir() {
+		lines = append(lines, field("Size", formatSize(p.Size)))
+	}
+	lines = append(lines, field("Modified", p.ModTime.Format("2006-01-02 15:04")))
+	if p.MIME != "" {
+		lines = append(lines, field("Type", p.MIME))
+	}
+	if p.Width > 0 {
+		lines = append(lines, field("Image", fmt.Sprintf("%d %s %d px", p.Width, icons.times, p.Height)))
+	}
+
+	if len(p.Lines) > 0 {
+		lines = append(lines, "")
+		lines = append(lines, p.Lines...)
+	}
+	if p.Total > 0 {
+		lines = append(lines, "", field("Entries", fmt.Sprint(p.Total)))
+		lines = append(lines, p.Entries...)
+		if more := p.Total - len(p.Entries); more > 0 {
+			lines = append(lines, fmt.Sprintf("... and %d more", more))
+		}
+	}
+	return lines
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
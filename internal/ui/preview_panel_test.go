@@ -0,0 +1,46 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+func TestPreviewPane(t *testing.T) {
+	m, _ := testModel(t, "notes.txt")
+	next, _ := m.Update(tea.WindowSizeMsg{Width: 100, Height: 30})
+	m = next.(model)
+	next, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("i")})
+	m = next.(model)
+	if cmd == nil || m.list.Width() != 100-previewWidth(100) {
+		t.Fatalf("expected the preview to be requested and the list to shrink, width %d", m.list.Width())
+	}
+	if !strings.Contains(ansi.Strip(m.View()), "Loading...") {
+		t.Fatal("expected the preview to be loading")
+	}
+
+	next, cmd = m.Update(previewDueMsg{name: "notes.txt"})
+	m = next.(model)
+	next, _ = m.Update(cmd())
+	m = next.(model)
+	view := ansi.Strip(m.View())
+	for _, expected := range []string{"Size      9 B", "text/plain", "notes.txt"} {
+		if !strings.Contains(view, expected) {
+			t.Fatalf("expected %q in the preview:\n%s", expected, view)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for size, expected := range map[int64]string{
+		512:         "512 B",
+		1536:        "1.5 KiB",
+		5 * 1 << 30: "5.0 GiB",
+	} {
+		if got := formatSize(size); got != expected {
+			t.Errorf("%d: expected %s, got %s", size, expected, got)
+		}
+	}
+}
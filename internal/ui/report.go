@@ -0,0 +1,253 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Outcomes of a change in the plan.
+const (
+	outcomeMoved   = "moved"
+	outcomeCreated = "created"
+	outcomeSkipped = "skipped"
+	outcomeFailed  = "failed"
+)
+
+// applyReport tells what became of every change in the plan once applied.
+type applyReport struct {
+	Started  time.Time     `json:"started"`
+	Elapsed  time.Duration `json:"-"`
+	Journal  string        `json:"journal,omitempty"`
+	Outcomes []outcome     `json:"outcomes"`
+}
+
+type outcome struct {
+	Action string `json:"action"`
+	Name   string `json:"name,omitempty"`
+	Result string `json:"result"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// count returns how many changes ended as status.
+func (r *applyReport) count(status string) int {
+	n := 0
+	for _, o := range r.Outcomes {
+		if o.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// add records an outcome, the reason taken from err if it failed.
+func (r *applyReport) add(it item, status string, err error) {
+	o := outcome{Action: strings.TrimPrefix(it.action, "!"), Name: it.name, Result: it.result, Status: status}
+	if err != nil {
+		o.Reason = err.Error()
+	}
+	r.Outcomes = append(r.Outcomes, o)
+}
+
+// skip records an item left as it is, if it was meant to change.
+func (r *applyReport) skip(it item) {
+	switch {
+	case it.rejected && it.name == "":
+		r.Outcomes = append(r.Outcomes, outcome{Action: "create", Result: it.result, Status: outcomeSkipped, Reason: "rejected"})
+	case it.rejected:
+		r.Outcomes = append(r.Outcomes, outcome{Action: "keep", Name: it.name, Result: it.result, Status: outcomeSkipped, Reason: "rejected"})
+	case it.conflict != "":
+		r.Outcomes = append(r.Outcomes, outcome{Action: "keep", Name: it.name, Result: it.result, Status: outcomeSkipped, Reason: "destination taken: " + it.conflict})
+	}
+}
+
+func (r *applyReport) summary() string {
+	return fmt.Sprintf("%d moved, %d created, %d skipped, %d failed in %s",
+		r.count(outcomeMoved), r.count(outcomeCreated), r.count(outcomeSkipped), r.count(outcomeFailed), r.Elapsed.Round(time.Millisecond))
+}
+
+// lines are the contents of the report pane, failures first.
+func (r *applyReport) lines() []string {
+	lines := []string{previewTitleStyle.Render("Applied: " + r.summary())}
+	if r.Journal != "" {
+		lines = append(lines, "Journal: "+r.Journal)
+	}
+	for _, status := range []string{outcomeFailed, outcomeSkipped} {
+		var section []string
+		for _, o := range r.Outcomes {
+			if o.Status == status {
+				section = append(section, fmt.Sprintf("  %s: %s", o.change(), o.Reason))
+			}
+		}
+		if len(section) > 0 {
+			title := fmt.Sprintf("%s%s (%d)", strings.ToUpper(status[:1]), status[1:], len(section))
+			lines = append(lines, "", previewTitleStyle.Render(title))
+			lines = append(lines, section...)
+		}
+	}
+	return lines
+}
+
+// change describes the change o was about.
+func (o outcome) change() string {
+	if o.Name == "" {
+		return fmt.Sprintf("%s %s", o.Action, o.Result)
+	}
+	if o.Name == o.Result {
+		return fmt.Sprintf("%s %s", o.Action, o.Name)
+	}
+	return fmt.Sprintf("%s %s %s %s", o.Action, o.Name, icons.moved, o.Result)
+}
+
+// markdown renders the report for a ticket or a pull request.
+func (r *applyReport) markdown() string {
+	var b strings.Builder
+	b.WriteString("# Norbot apply report\n\n")
+	fmt.Fprintf(&b, "- Started: %s\n", r.Started.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Elapsed: %s\n", r.Elapsed.Round(time.Millisecond))
+	if r.Journal != "" {
+		fmt.Fprintf(&b, "- Journal: `%s`\n", r.Journal)
+	}
+	b.WriteString("\n| Moved | Created | Skipped | Failed |\n|---|---|---|---|\n")
+	fmt.Fprintf(&b, "| %d | %d | %d | %d |\n",
+		r.count(outcomeMoved), r.count(outcomeCreated), r.count(outcomeSkipped), r.count(outcomeFailed))
+
+	for _, status := range []string{outcomeFailed, outcomeSkipped, outcomeMoved, outcomeCreated} {
+		if r.count(status) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n## %s%s\n\n| Action | From | To | Reason |\n|---|---|---|---|\n", strings.ToUpper(status[:1]), status[1:])
+		for _, o := range r.Outcomes {
+			if o.Status == status {
+				fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", o.Action, markdownCell(o.Name), markdownCell(o.Result), markdownCell(o.Reason))
+			}
+		}
+	}
+	return b.String()
+}
+
+// markdownCell keeps s from breaking the table it is put in.
+func markdownCell(s string) string {
+	if s == "" {
+		return ""
+	}
+	s = strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+	return "`" + strings.ReplaceAll(s, "`", "'") + "`"
+}
+
+func (r *applyReport) json() ([]byte, error) {
+	type counts struct {
+		Moved   int `json:"moved"`
+		Created int `json:"created"`
+		Skipped int `json:"skipped"`
+		Failed  int `json:"failed"`
+	}
+	return json.MarshalIndent(struct {
+		*applyReport
+		Elapsed float64 `json:"elapsed_seconds"`
+		Counts  counts  `json:"counts"`
+	}{
+		applyReport: r,
+		Elapsed:     r.Elapsed.Seconds(),
+		Counts:      counts{r.count(outcomeMoved), r.count(outcomeCreated), r.count(outcomeSkipped), r.count(outcomeFailed)},
+	}, "", "  ")
+}
+
+type reportExportedMsg struct {
+	paths []string
+	err   error
+}
+
+// exportReport writes the report as Markdown and JSON next to the journal,
+// or into dir without one, never into the directory being organized. A
+// file already there is left alone.
+func exportReport(r *applyReport, dir string) tea.Cmd {
+	return func() tea.Msg {
+		if dir == "" {
+			dir = os.TempDir()
+		}
+		base := filepath.Join(dir, "norbot-report-"+r.Started.Format(timestampFormat))
+		if r.Journal != "" {
+			base = strings.TrimSuffix(r.Journal, filepath.Ext(r.Journal)) + ".report"
+		}
+		if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+			return reportExportedMsg{err: err}
+		}
+		data, err := r.json()
+		if err != nil {
+			return reportExportedMsg{err: err}
+		}
+		paths := []string{base + ".md", base + ".json"}
+		for i, contents := range [][]byte{[]byte(r.markdown()), data} {
+			if err := writeNew(paths[i], contents); err != nil {
+				return reportExportedMsg{err: err}
+			}
+		}
+		return reportExportedMsg{paths: paths}
+	}
+}
+
+// writeNew writes data to a file named name, which must not exist yet.
+func writeNew(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// scrollReport moves the report pane by delta lines.
+func (m *model) scrollReport(delta int) {
+	last := len(m.report.lines()) - m.list.Height()
+	m.reportOffset = max(min(m.reportOffset+delta, last), 0)
+}
+
+// updateReport scrolls and exports the report, ok tells if msg was one of
+// its keys.
+func (m model) updateReport(msg tea.KeyMsg) (tea.Model, tea.Cmd, bool) {
+	switch {
+	case key.Matches(msg, m.keys.up):
+		m.scrollReport(-1)
+	case key.Matches(msg, m.keys.down):
+		m.scrollReport(1)
+	case key.Matches(msg, m.keys.pageUp):
+		m.scrollReport(-m.list.Height())
+	case key.Matches(msg, m.keys.pageDown):
+		m.scrollReport(m.list.Height())
+	case key.Matches(msg, m.keys.export):
+		if m.exported != nil {
+			// Written already, its paths are shown.
+			return m, nil, true
+		}
+		return m, exportReport(m.report, m.options.ReportDir), true
+	default:
+		return m, nil, false
+	}
+	return m, nil, true
+}
+
+// reportView draws the part of the report pane scrolled to.
+func (m model) reportView() string {
+	width := max(m.list.Width()-rowIndent, 1)
+	lines := m.report.lines()
+	start := min(m.reportOffset, len(lines))
+	end := min(start+m.list.Height(), len(lines))
+	var shown []string
+	for _, line := range lines[start:end] {
+		shown = append(shown, ansi.Truncate(line, width, icons.ellipsis))
+	}
+	return lipgloss.NewStyle().PaddingLeft(rowIndent).Height(m.list.Height()).Render(strings.Join(shown, "\n"))
+}
@@ -0,0 +1,127 @@
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atlomak/norbot/internal/llm"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+func TestApplyReport(t *testing.T) {
+	m, fsys := testModel(t, "a|b.txt", "c.txt", "d.txt")
+	m.updateResults([]llm.Action{
+		{Type: "move", Name: "a|b.txt", Result: "docs/a|b.txt"},
+		{Type: "move", Name: "c.txt", Result: "notes/c.txt"},
+		{Type: "move", Name: "d.txt", Result: "old/d.txt"},
+	})
+	for i, it := range m.items {
+		if it.name == "d.txt" {
+			m.items[i] = m.toggleItemAction(it)
+		}
+	}
+	m.syncCreates()
+	// Something shows up where c.txt is going.
+	if err := fsys.MkdirAll("notes/c.txt", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := m.applyChanges().(applyChangesMsg)
+	if msg.err == nil {
+		t.Fatal("expected the move of c.txt to fail")
+	}
+	r := msg.report
+	if got := [4]int{r.count(outcomeMoved), r.count(outcomeCreated), r.count(outcomeSkipped), r.count(outcomeFailed)}; got != [4]int{1, 2, 2, 1} {
+		t.Fatalf("expected 1 moved, 2 created, 2 skipped and 1 failed, got %v", got)
+	}
+	if _, err := fsys.Lstat("docs/a|b.txt"); err != nil {
+		t.Errorf("expected the rest applied past the failure: %v", err)
+	}
+
+	lines := ansi.Strip(strings.Join(r.lines(), "\n"))
+	for _, expected := range []string{"Failed (1)", "move c.txt → notes/c.txt: ", "Skipped (2)", "keep d.txt: rejected"} {
+		if !strings.Contains(lines, expected) {
+			t.Errorf("expected %q in the report:\n%s", expected, lines)
+		}
+	}
+
+	md := r.markdown()
+	for _, expected := range []string{"| 1 | 2 | 2 | 1 |", "## Failed", "| move | `a\\|b.txt` | `docs/a\\|b.txt` |  |"} {
+		if !strings.Contains(md, expected) {
+			t.Errorf("expected %q in the Markdown:\n%s", expected, md)
+		}
+	}
+
+	data, err := r.json()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Counts   map[string]int `json:"counts"`
+		Outcomes []outcome      `json:"outcomes"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Counts["failed"] != 1 || len(decoded.Outcomes) != len(r.Outcomes) {
+		t.Errorf("expected the counts and outcomes in the JSON:\n%s", data)
+	}
+}
+
+func TestFinishReport(t *testing.T) {
+	m, _ := testModel(t, "a.txt")
+	m.options.Journal = filepath.Join(t.TempDir(), "20240101-120000.jsonl")
+	m.updateResults([]llm.Action{{Type: "move", Name: "a.txt", Result: "docs/a.txt"}})
+	m.status = Ready
+
+	next, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}})
+	next, _ = next.Update(cmd())
+	m = next.(model)
+	view := ansi.Strip(m.View())
+	if m.status != Finished || !strings.Contains(view, "1 moved, 1 created, 0 skipped, 0 failed") {
+		t.Fatalf("expected the report, got status %d:\n%s", m.status, view)
+	}
+
+	next, cmd = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'x'}})
+	next, _ = next.Update(cmd())
+	m = next.(model)
+	if m.exportErr != nil {
+		t.Fatal(m.exportErr)
+	}
+	base := strings.TrimSuffix(m.options.Journal, ".jsonl")
+	for _, name := range []string{base + ".report.md", base + ".report.json"} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("expected the report exported: %v", err)
+		}
+	}
+	if _, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'x'}}); cmd != nil {
+		t.Error("expected a report exported once")
+	}
+}
+
+func TestExportReportWithoutJournal(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "reports")
+	r := &applyReport{Started: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+
+	msg := exportReport(r, dir)().(reportExportedMsg)
+	if msg.err != nil {
+		t.Fatal(msg.err)
+	}
+	for _, name := range msg.paths {
+		if filepath.Dir(name) != dir {
+			t.Errorf("expected %s in %s", name, dir)
+		}
+	}
+
+	// A report of the same name is not overwritten.
+	if msg := exportReport(r, dir)().(reportExportedMsg); !errors.Is(msg.err, fs.ErrExist) {
+		t.Errorf("expected the existing report kept, got %v", msg.err)
+	}
+}
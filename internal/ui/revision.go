@@ -0,0 +1,118 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/atlomak/norbot/internal/llm"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// planChange is a file whose destination a revision of the plan changed.
+type planChange struct {
+	name          string
+	before, after string
+}
+
+// diffPlans lists the files going somewhere else in plan than in previous.
+// A file missing from a plan stays where it is.
+func diffPlans(previous, plan []llm.Action) []planChange {
+	results := func(plan []llm.Action) map[string]string {
+		m := make(map[string]string, len(plan))
+		for _, a := range plan {
+			m[a.Name] = a.Result
+		}
+		return m
+	}
+	before, after := results(previous), results(plan)
+
+	var changes []planChange
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			after[name] = name
+		}
+	}
+	for name, result := range after {
+		was, ok := before[name]
+		if !ok {
+			was = name
+		}
+		if was != result {
+			changes = append(changes, planChange{name: name, before: was, after: result})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].name < changes[j].name })
+	return changes
+}
+
+// maxSummaryChanges limits the changes spelled out in the status panel,
+// the list marks all of them.
+const maxSummaryChanges = 3
+
+// revisionSummary tells what the last follow-up prompt changed.
+func (m model) revisionSummary() string {
+	if len(m.changes) == 0 {
+		return fmt.Sprintf("Revision %d changed nothing. Press p to ask for something else.", m.revision)
+	}
+	var moves []string
+	for _, c := range m.changes[:min(len(m.changes), maxSummaryChanges)] {
+		moves = append(moves, fmt.Sprintf("%s: %s %s %s", c.name, c.before, icons.moved, c.after))
+	}
+	s := fmt.Sprintf("Revision %d changed %d files: %s", m.revision, len(m.changes), strings.Join(moves, ", "))
+	if len(m.changes) > maxSummaryChanges {
+		s += fmt.Sprintf(" (%d more)", len(m.changes)-maxSummaryChanges)
+	}
+	return s
+}
+
+// reviewedPlan returns the plan as the user left it, with rejected files
+// kept in place, and the suggestions they rejected.
+func (m model) reviewedPlan() (plan, rejected []llm.Action) {
+	rejectedNames := make(map[string]bool)
+	for _, it := range m.items {
+		if it.rejected && it.name != "" {
+			rejectedNames[it.name] = true
+			if a, ok := m.actions[it.name]; ok && a.Type == "move" {
+				rejected = append(rejected, a)
+			}
+		}
+	}
+	for _, a := range m.plan {
+		if rejectedNames[a.Name] {
+			a = llm.Action{Type: "keep", Name: a.Name, Result: a.Name}
+		}
+		plan = append(plan, a)
+	}
+	return plan, rejected
+}
+
+// startRevision asks for the current plan to be changed as prompt says,
+// continuing the conversation that produced it.
+func (m *model) startRevision(prompt string) tea.Cmd {
+	plan, rejected := m.reviewedPlan()
+	chat := m.chat
+	cmd := m.startStream(chat, true, func(ctx context.Context, received chan<- llm.Received) ([]llm.Plan, error) {
+		return chat.Revise(ctx, prompt, plan, rejected, received)
+	})
+	m.stream.retry = func(m *model) tea.Cmd { return m.startRevision(prompt) }
+	return cmd
+}
+
+// reviseResults replaces the plan by a revision of it, keeping the review
+// work done on the files the revision leaves alone.
+func (m *model) reviseResults(actions []llm.Action) tea.Cmd {
+	m.previous = m.plan
+	m.revision++
+	return m.applyRevision(actions)
+}
+
+// applyRevision puts actions in place of the plan the last revision
+// started from.
+func (m *model) applyRevision(actions []llm.Action) tea.Cmd {
+	actions = matchNames(actions, m.files)
+	m.plan, m.resolved = newConflictResolver(m.fsys, m.options.Conflicts).resolve(actions)
+	m.changes = diffPlans(m.previous, m.plan)
+	return m.replan()
+}
@@ -0,0 +1,83 @@
+package ui
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/atlomak/norbot/internal/llm"
+)
+
+func TestDiffPlans(t *testing.T) {
+	previous := []llm.Action{
+		{Type: "move", Name: "a.jpg", Result: "photos/a.jpg"},
+		{Type: "move", Name: "b.png", Result: "photos/b.png"},
+		{Type: "keep", Name: "notes.txt", Result: "notes.txt"},
+	}
+	plan := []llm.Action{
+		{Type: "move", Name: "a.jpg", Result: "photos/a.jpg"},
+		{Type: "keep", Name: "b.png", Result: "b.png"},
+		{Type: "move", Name: "notes.txt", Result: "texts/notes.txt"},
+	}
+	expected := []planChange{
+		{name: "b.png", before: "photos/b.png", after: "b.png"},
+		{name: "notes.txt", before: "notes.txt", after: "texts/notes.txt"},
+	}
+	if got := diffPlans(previous, plan); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestReviseResults(t *testing.T) {
+	m, _ := testModel(t, "a.jpg", "screenshot.png", "notes.txt")
+	m.updateResults([]llm.Action{
+		{Type: "move", Name: "a.jpg", Result: "photos/a.jpg"},
+		{Type: "move", Name: "screenshot.png", Result: "photos/screenshot.png"},
+		{Type: "move", Name: "notes.txt", Result: "texts/notes.txt"},
+	})
+	for i, it := range m.items {
+		if it.name == "notes.txt" {
+			m.items[i] = m.toggleItemAction(it)
+		}
+	}
+	m.syncCreates()
+
+	plan, rejected := m.reviewedPlan()
+	expectedPlan := []llm.Action{
+		{Type: "move", Name: "a.jpg", Result: "photos/a.jpg"},
+		{Type: "move", Name: "screenshot.png", Result: "photos/screenshot.png"},
+		{Type: "keep", Name: "notes.txt", Result: "notes.txt"},
+	}
+	if !reflect.DeepEqual(plan, expectedPlan) {
+		t.Fatalf("expected plan %v, got %v", expectedPlan, plan)
+	}
+	expectedRejected := []llm.Action{{Type: "move", Name: "notes.txt", Result: "texts/notes.txt"}}
+	if !reflect.DeepEqual(rejected, expectedRejected) {
+		t.Fatalf("expected rejected %v, got %v", expectedRejected, rejected)
+	}
+
+	// "keep screenshots at top level", with the model still moving notes.txt.
+	m.reviseResults([]llm.Action{
+		{Type: "move", Name: "a.jpg", Result: "photos/a.jpg"},
+		{Type: "keep", Name: "screenshot.png", Result: "screenshot.png"},
+		{Type: "move", Name: "notes.txt", Result: "texts/notes.txt"},
+	})
+	expected := []string{
+		"create  -> photos/",
+		"keep screenshot.png -> screenshot.png",
+		"move a.jpg -> photos/a.jpg",
+		"x !create  -> texts/",
+		"x keep notes.txt -> notes.txt",
+	}
+	if got := planString(m.items); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("\nexpected: %q\ngot:      %q", expected, got)
+	}
+
+	m.setFilter("revised")
+	var got []string
+	for _, r := range m.list.Items() {
+		got = append(got, r.(treeRow).item.revised)
+	}
+	if expected := []string{"photos/screenshot.png"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
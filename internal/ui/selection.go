@@ -0,0 +1,249 @@
+package ui
+
+import (
+	"path"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// itemKey identifies an item across changes to the plan: files by name,
+// new directories by where they go.
+func itemKey(it item) string {
+	if it.name == "" {
+		return "+" + it.result
+	}
+	return it.name
+}
+
+// selectable reports whether row stands for an item bulk operations apply to.
+func selectable(row treeRow) bool {
+	return row.node.item >= 0 && !row.item.immovable
+}
+
+// selection returns the indexes of the marked items, including the range
+// of a visual selection in progress.
+func (m model) selection() []int {
+	marked := make(map[string]bool)
+	for k := range m.selected {
+		marked[k] = true
+	}
+	if m.visual {
+		lo, hi := min(m.anchor, m.list.Index()), max(m.anchor, m.list.Index())
+		for i, r := range m.list.Items() {
+			if row, ok := r.(treeRow); ok && i >= lo && i <= hi && selectable(row) {
+				marked[itemKey(row.item)] = true
+			}
+		}
+	}
+
+	var indexes []int
+	for i, it := range m.items {
+		if marked[itemKey(it)] {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// markRows updates the marks shown in the list without rebuilding the tree.
+func (m *model) markRows() {
+	marked := make(map[int]bool)
+	for _, i := range m.selection() {
+		marked[i] = true
+	}
+	for i, r := range m.list.Items() {
+		row, ok := r.(treeRow)
+		if ok && row.node.item >= 0 && row.marked != marked[row.node.item] {
+			row.marked = !row.marked
+			m.list.SetItem(i, row)
+		}
+	}
+}
+
+func (m *model) clearSelection() {
+	m.selected = make(map[string]bool)
+	m.visual = false
+	m.markRows()
+}
+
+// toggleMark marks or unmarks the selected row.
+func (m *model) toggleMark() {
+	row, ok := m.list.SelectedItem().(treeRow)
+	if !ok || !selectable(row) {
+		return
+	}
+	key := itemKey(row.item)
+	if m.selected[key] {
+		delete(m.selected, key)
+	} else {
+		m.selected[key] = true
+	}
+	m.markRows()
+}
+
+// toggleVisual starts a range selection at the selected row, or ends it,
+// keeping the range marked.
+func (m *model) toggleVisual() {
+	if m.visual {
+		for _, i := range m.selection() {
+			m.selected[itemKey(m.items[i])] = true
+		}
+		m.visual = false
+	} else {
+		m.visual = true
+		m.anchor = m.list.Index()
+	}
+	m.markRows()
+}
+
+// markWhere marks every item the selected row's item has in common with,
+// as decided by same, leaving out the ones the filter hides.
+func (m *model) markWhere(same func(selected, other item) bool) {
+	row, ok := m.list.SelectedItem().(treeRow)
+	if !ok {
+		return
+	}
+	shown := m.filtered()
+	for i, it := range m.items {
+		if shown != nil && !shown[i] {
+			continue
+		}
+		if !it.immovable && same(row.item, it) {
+			m.selected[itemKey(it)] = true
+		}
+	}
+	m.markRows()
+}
+
+// markDirectory marks everything inside the selected directory.
+func (m *model) markDirectory() {
+	row, ok := m.list.SelectedItem().(treeRow)
+	if !ok || !row.node.isDir() {
+		return
+	}
+	place := proposedPath(m.items)
+	m.markWhere(func(_, it item) bool {
+		p := place(it)
+		return p != row.node.path && strings.HasPrefix(p, row.node.path)
+	})
+}
+
+// markSameAction marks every item with the action of the selected one.
+func (m *model) markSameAction() {
+	m.markWhere(func(selected, it item) bool {
+		return selected.action != "" && it.action == selected.action
+	})
+}
+
+// markSameFolder marks every item going to the folder of the selected one.
+func (m *model) markSameFolder() {
+	place := proposedPath(m.items)
+	row, ok := m.list.SelectedItem().(treeRow)
+	if !ok {
+		return
+	}
+	folder := parentOf(row.node.path)
+	m.markWhere(func(_, it item) bool {
+		return parentOf(place(it)) == folder
+	})
+}
+
+// toggleSelection rejects every marked item, or accepts them all again when
+// they all are rejected already.
+func (m *model) toggleSelection() tea.Cmd {
+	indexes := m.selection()
+	reject := false
+	for _, i := range indexes {
+		if !m.items[i].rejected {
+			reject = true
+		}
+	}
+	for _, i := range indexes {
+		if m.items[i].rejected != reject {
+			m.items[i] = m.toggleItemAction(m.items[i])
+		}
+	}
+	m.syncCreates()
+	return m.refreshTree()
+}
+
+// retargetSelection moves every marked item into folder, keeping its name.
+func (m *model) retargetSelection(folder string) (tea.Cmd, error) {
+	folder = strings.TrimSuffix(strings.TrimSpace(folder), "/") + "/"
+	results := make(map[string]string)
+	for _, i := range m.selection() {
+		it := m.items[i]
+		if it.name == "" {
+			continue
+		}
+		base := path.Base(it.result)
+		if strings.HasSuffix(it.name, "/") {
+			base += "/"
+		}
+		result, err := destination(it.name, folder+base)
+		if err != nil {
+			return nil, err
+		}
+		results[it.name] = result
+	}
+	return m.setDestinations(results), nil
+}
+
+// stripRenames keeps the moves of the marked items, or of the selected one,
+// but under their current names.
+func (m *model) stripRenames() tea.Cmd {
+	indexes := m.selection()
+	if row, ok := m.list.SelectedItem().(treeRow); ok && len(indexes) == 0 && selectable(row) {
+		indexes = []int{row.node.item}
+	}
+
+	results := make(map[string]string)
+	for _, i := range indexes {
+		it := m.items[i]
+		if it.action != "move" || it.rejected {
+			continue
+		}
+		base := path.Base(it.name)
+		if strings.HasSuffix(it.name, "/") {
+			base += "/"
+		}
+		if result := parentOf(it.result) + base; result != it.result {
+			results[it.name] = result
+		}
+	}
+	if len(results) == 0 {
+		return nil
+	}
+	return m.setDestinations(results)
+}
+
+// syncCreates rejects new directories once every file planned to go into
+// them is rejected, and accepts them again when one is accepted.
+func (m *model) syncCreates() {
+	for i, dir := range m.items {
+		if dir.name != "" || (dir.action != "create" && dir.action != "!create") {
+			continue
+		}
+		children, accepted := 0, 0
+		for _, it := range m.items {
+			if it.name == "" {
+				continue
+			}
+			result := it.result
+			if it.rejected {
+				result = m.actions[it.name].Result
+			}
+			if !strings.HasPrefix(result, dir.result) {
+				continue
+			}
+			children++
+			if !it.rejected {
+				accepted++
+			}
+		}
+		if children > 0 && (accepted == 0) != dir.rejected {
+			m.items[i] = m.toggleItemAction(dir)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package ui
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/atlomak/norbot/internal/llm"
+)
+
+// markNames marks the items with the given names, or new directories when
+// prefixed with a plus.
+func markNames(m *model, keys ...string) {
+	for _, key := range keys {
+		m.selected[key] = true
+	}
+	m.markRows()
+}
+
+func TestToggleSelection(t *testing.T) {
+	m, _ := testModel(t, "a.jpg", "b.jpg", "notes.txt")
+	m.updateResults([]llm.Action{
+		{Type: "move", Name: "a.jpg", Result: "photos/a.jpg"},
+		{Type: "move", Name: "b.jpg", Result: "photos/b.jpg"},
+		{Type: "move", Name: "notes.txt", Result: "texts/notes.txt"},
+	})
+
+	markNames(&m, "a.jpg", "b.jpg")
+	m.toggleSelection()
+	// photos/ has nothing left to hold, so it is rejected along with them.
+	expected := []string{
+		"create  -> texts/",
+		"move notes.txt -> texts/notes.txt",
+		"x !create  -> photos/",
+		"x keep a.jpg -> a.jpg",
+		"x keep b.jpg -> b.jpg",
+	}
+	if got := planString(m.items); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("\nexpected: %q\ngot:      %q", expected, got)
+	}
+
+	m.clearSelection()
+	markNames(&m, "a.jpg")
+	m.toggleSelection()
+	expected = []string{
+		"create  -> photos/",
+		"create  -> texts/",
+		"move a.jpg -> photos/a.jpg",
+		"move notes.txt -> texts/notes.txt",
+		"x keep b.jpg -> b.jpg",
+	}
+	if got := planString(m.items); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("\nexpected: %q\ngot:      %q", expected, got)
+	}
+}
+
+func TestMarkSameAction(t *testing.T) {
+	m, _ := testModel(t, "a.jpg", "b.jpg", "notes.txt")
+	m.updateResults([]llm.Action{
+		{Type: "move", Name: "a.jpg", Result: "photos/a.jpg"},
+		{Type: "move", Name: "b.jpg", Result: "photos/b.jpg"},
+		{Type: "keep", Name: "notes.txt", Result: "notes.txt"},
+	})
+	for i, r := range m.list.Items() {
+		if row := r.(treeRow); row.node.item >= 0 && row.item.name == "notes.txt" {
+			m.list.Select(i)
+		}
+	}
+
+	m.markSameAction()
+	var got []string
+	for _, i := range m.selection() {
+		got = append(got, m.items[i].name)
+	}
+	if expected := []string{"notes.txt"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestRetargetSelection(t *testing.T) {
+	m, _ := testModel(t, "a.jpg", "b.jpg", "notes.txt")
+	m.updateResults([]llm.Action{
+		{Type: "move", Name: "a.jpg", Result: "photos/a.jpg"},
+		{Type: "move", Name: "b.jpg", Result: "photos/b.jpg"},
+		{Type: "move", Name: "notes.txt", Result: "texts/notes.txt"},
+	})
+
+	markNames(&m, "a.jpg", "b.jpg")
+	if _, err := m.retargetSelection("media/"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"create  -> media/",
+		"create  -> texts/",
+		"move a.jpg -> media/a.jpg",
+		"move b.jpg -> media/b.jpg",
+		"move notes.txt -> texts/notes.txt",
+	}
+	if got := planString(m.items); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("\nexpected: %q\ngot:      %q", expected, got)
+	}
+
+	if _, err := m.retargetSelection("../elsewhere"); err == nil {
+		t.Fatal("expected a folder outside the directory to be refused")
+	}
+}
+
+func TestStripRenames(t *testing.T) {
+	m, _ := testModel(t, "IMG 1.jpg", "IMG 2.jpg", "notes.txt")
+	m.updateResults([]llm.Action{
+		{Type: "move", Name: "IMG 1.jpg", Result: "photos/img_1.jpg"},
+		{Type: "move", Name: "IMG 2.jpg", Result: "img_2.jpg"},
+		{Type: "move", Name: "notes.txt", Result: "texts/notes.txt"},
+	})
+
+	markNames(&m, "IMG 1.jpg", "IMG 2.jpg", "notes.txt")
+	m.stripRenames()
+	expected := []string{
+		"create  -> photos/",
+		"create  -> texts/",
+		"keep IMG 2.jpg -> IMG 2.jpg",
+		"move IMG 1.jpg -> photos/IMG 1.jpg",
+		"move notes.txt -> texts/notes.txt",
+	}
+	if got := planString(m.items); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("\nexpected: %q\ngot:      %q", expected, got)
+	}
+}
@@ -1,22 +1,23 @@
 package ui
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/charmbracelet/lipgloss"
 )
 
 var (
 	statusPanelStyle = lipgloss.NewStyle().
-				Width(120).
-				Height(10).
 				Align(lipgloss.Left, lipgloss.Top).
 				PaddingLeft(2)
-	statusTitleStyle  = lipgloss.NewStyle().MarginLeft(1).Foreground(lipgloss.Color(gnomeGreen))
+	statusTitleStyle  = lipgloss.NewStyle().MarginLeft(1)
 	bottomStatusStyle = lipgloss.NewStyle().Margin(2)
+	warningStyle      = lipgloss.NewStyle().MarginLeft(2)
+	noteStyle         = lipgloss.NewStyle().MarginLeft(2)
 	promptInputStyle  = lipgloss.NewStyle().
-				Width(80).
 				MarginLeft(2).
-				BorderStyle(lipgloss.NormalBorder()).
-				BorderForeground(lipgloss.Color(gnomeGreen))
+				BorderStyle(lipgloss.NormalBorder())
 )
 
 const (
@@ -26,44 +27,173 @@ const (
   /    / / /_/ / / , _/ / _  |/ /_/ / / /   
  /_/|_/  \____/ /_/|_| /____/ \____/ /_/      
 `
-	gnomeGreen = "#39FF14"
-	darkGreen  = "#243407"
 )
 
+const (
+	// defaultWidth is assumed until the terminal tells its size.
+	defaultWidth = 120
+	// panelHeight and compactPanelHeight are the heights of the status
+	// panel with the logo and, on small terminals, without it.
+	panelHeight        = 10
+	compactPanelHeight = 5
+	// logoWidth and logoHeight are what the terminal needs at least for
+	// the logo to be drawn.
+	logoWidth  = 50
+	logoHeight = 24
+	// maxInputWidth keeps inputs readable on wide terminals.
+	maxInputWidth = 80
+)
+
+// compact reports whether the terminal is too small for the logo.
+func (m model) compact() bool {
+	return (m.width > 0 && m.width < logoWidth) || (m.height > 0 && m.height < logoHeight)
+}
+
+func (m model) panelHeight() int {
+	if m.compact() {
+		return compactPanelHeight
+	}
+	return panelHeight
+}
+
+// panelStyle sizes the status panel to the terminal, cutting off what does
+// not fit rather than pushing the list down.
+func (m model) panelStyle() lipgloss.Style {
+	width := m.width
+	if width == 0 {
+		width = defaultWidth
+	}
+	return statusPanelStyle.Width(width).Height(m.panelHeight()).MaxHeight(m.panelHeight())
+}
+
+func (m model) inputStyle() lipgloss.Style {
+	width := m.width
+	if width == 0 {
+		width = defaultWidth
+	}
+	return promptInputStyle.Width(min(maxInputWidth, width-8))
+}
+
+// banner renders the logo, or just the name on small terminals.
+func (m model) banner() string {
+	if m.compact() {
+		return statusTitleStyle.Render("NORBOT")
+	}
+	return statusTitleStyle.Render(norbot)
+}
+
 func (m model) welcomePanelView() string {
-	s := statusTitleStyle.Render(norbot)
-	s += bottomStatusStyle.Render("Press enter to unleash the gnomes...")
+	s := m.banner()
+	if m.scanning {
+		s += bottomStatusStyle.Render(fmt.Sprintf("Scanning... %d files found", m.scanned))
+		return s
+	}
+	s += m.hintView(fmt.Sprintf("Press %s to unleash the gnomes, %s for help...", m.keys.plan.Help().Key, m.keys.help.Help().Key))
 	return s
 }
 
 func (m model) inputPanelView() string {
-	s := statusTitleStyle.Render(norbot)
+	s := m.banner()
 	s += "\n"
-	s += promptInputStyle.Render(m.textInput.View())
+	s += m.inputStyle().Render(m.textInput.View())
 	s += "\n"
 	return s
 }
 
 func (m model) loadingPanelView() string {
-	s := statusTitleStyle.Render(norbot)
-	s += bottomStatusStyle.Render(m.progress.View())
+	s := m.banner()
+	s += bottomStatusStyle.MarginBottom(0).Render(m.progress.View())
+	s += "\n" + noteStyle.Render(fmt.Sprintf("%d of %d files planned. Press %s to cancel.", len(m.furthest()), m.expected(), m.keys.cancel.Help().Key))
 	return s
 }
 
 func (m model) readyPanelView() string {
-	s := statusTitleStyle.Render(norbot)
-	s += bottomStatusStyle.Render("Press y to apply Norbot changes. Press space to reject selected file.")
+	s := m.banner()
+	s += m.hintView(fmt.Sprintf("Press %s to apply Norbot changes. Press %s to reject selected file, %s to change where it goes.",
+		m.keys.apply.Help().Key, m.keys.reject.Help().Key, m.keys.edit.Help().Key))
+	if len(m.candidates) > 1 {
+		s += "\n" + noteStyle.Render(m.candidatesView())
+	}
+	if m.revision > 0 {
+		s += "\n" + noteStyle.Render(m.revisionSummary())
+	}
+	if m.filter != "" {
+		s += "\n" + noteStyle.Render(fmt.Sprintf("Filter: %s (%d of %d items), %s shows all", m.filter, m.shownCount(), len(m.items), m.keys.cancel.Help().Key))
+	}
+	return s
+}
+
+func (m model) filterPanelView() string {
+	s := m.banner()
+	s += "\n" + noteStyle.Render(fmt.Sprintf("Show items matching (%d of %d):", m.shownCount(), len(m.items)))
+	s += "\n" + m.inputStyle().Render(m.filterInput.View())
+	s += "\n" + noteStyle.Render(fmt.Sprintf("%s keeps the filter, %s clears it", m.keys.confirm.Help().Key, m.keys.cancel.Help().Key))
+	return s
+}
+
+func (m model) editPanelView() string {
+	s := m.banner()
+	if m.editing == "" {
+		s += "\n" + noteStyle.Render(fmt.Sprintf("Move %d marked items into:", len(m.selection())))
+	} else {
+		s += "\n" + noteStyle.Render(fmt.Sprintf("Move %s to:", m.editing))
+	}
+	s += "\n" + m.inputStyle().Render(m.editInput.View())
+	switch {
+	case m.editErr != nil:
+		s += "\n" + warningStyle.Render("! "+m.editErr.Error())
+	case len(m.completions) > maxCompletions:
+		s += "\n" + noteStyle.Render(strings.Join(m.completions[:maxCompletions], "  ")+fmt.Sprintf("  (%d more)", len(m.completions)-maxCompletions))
+	case len(m.completions) > 0:
+		s += "\n" + noteStyle.Render(strings.Join(m.completions, "  "))
+	default:
+		s += "\n" + noteStyle.Render(fmt.Sprintf("%s completes directories, %s saves, %s cancels",
+			m.keys.complete.Help().Key, m.keys.confirm.Help().Key, m.keys.cancel.Help().Key))
+	}
+	return s
+}
+
+func (m model) reviewPanelView() string {
+	s := m.banner()
+	s += bottomStatusStyle.Render(fmt.Sprintf("The moves broke %d links. Press %s to update them, %s to leave them. Press %s to skip selected link.",
+		len(m.list.Items()), m.keys.apply.Help().Key, m.keys.decline.Help().Key, m.keys.reject.Help().Key))
 	return s
 }
 
 func (m model) finishPanelView() string {
-	s := statusTitleStyle.Render(norbot)
+	s := m.banner()
 	s += bottomStatusStyle.Render("Norbot finished. Bowing. More bowing")
+	if m.report != nil {
+		s += "\n" + noteStyle.Render(m.report.summary()+".")
+	}
+	if m.options.Journal != "" {
+		s += "\n" + noteStyle.Render(fmt.Sprintf("Changes recorded in %s, revert with norbot -undo", m.options.Journal))
+	}
+	switch {
+	case m.exportErr != nil:
+		s += "\n" + warningStyle.Render("! "+m.exportErr.Error())
+	case m.exported != nil:
+		s += "\n" + noteStyle.Render("Report written to "+strings.Join(m.exported, " and "))
+	case m.report != nil:
+		s += "\n" + noteStyle.Render(fmt.Sprintf("Press %s to export the report as Markdown and JSON.", m.keys.export.Help().Key))
+	}
 	return s
 }
 
 func (m model) errorPanelView() string {
-	s := norbot
-	s += bottomStatusStyle.Render("Norbot encountered an error! Geez...")
+	s := m.banner()
+	summary, hint := classify(m.failure.err)
+	s += bottomStatusStyle.Render(fmt.Sprintf("Geez, Norbot ran into a problem while %s. %s", m.failure.op, summary))
+	s += "\n" + noteStyle.Render(hint)
+	return s
+}
+
+// hintView renders the hint below the logo, followed by any warnings.
+func (m model) hintView(hint string) string {
+	if len(m.warnings) == 0 {
+		return bottomStatusStyle.Render(hint)
+	}
+	s := bottomStatusStyle.MarginBottom(0).Render(hint)
+	s += "\n" + warningStyle.Render("! "+strings.Join(m.warnings, "\n! "))
 	return s
 }
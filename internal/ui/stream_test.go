@@ -0,0 +1,128 @@
+package ui
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/atlomak/norbot/internal/llm"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestPlanStreamWait(t *testing.T) {
+	s := &planStream{received: make(chan llm.Received, 4), result: make(chan queryResultMsg, 1)}
+	s.received <- llm.Received{Action: llm.Action{Type: "keep", Name: "a.txt", Result: "a.txt"}}
+	s.received <- llm.Received{Action: llm.Action{Type: "keep", Name: "b.txt", Result: "b.txt"}}
+	close(s.received)
+	s.result <- queryResultMsg{stream: s}
+
+	progress, ok := s.wait().(streamProgressMsg)
+	if !ok || len(progress.received) != 2 {
+		t.Fatalf("expected both actions to be reported, got %#v", progress)
+	}
+	if _, ok := s.wait().(queryResultMsg); !ok {
+		t.Fatal("expected the result after the actions")
+	}
+}
+
+func TestReceiveAndCancel(t *testing.T) {
+	m, _ := testModel(t, "a.jpg", "notes.txt")
+	cancelled := false
+	m.stream = &planStream{cancel: func() { cancelled = true }}
+	m.streamed = make(map[int][]llm.Action)
+	m.status = Waiting
+
+	m.receive([]llm.Received{
+		{Candidate: 1, Action: llm.Action{Type: "move", Name: "a.jpg", Result: "photos/a.jpg"}},
+	})
+	expected := []string{
+		"create  -> photos/",
+		"keep notes.txt -> notes.txt",
+		"move a.jpg -> photos/a.jpg",
+	}
+	if got := planString(m.items); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("\nexpected: %q\ngot:      %q", expected, got)
+	}
+
+	// The partial plan is only shown, not applied or edited.
+	for _, msg := range []tea.KeyMsg{
+		{Type: tea.KeyRunes, Runes: []rune{'y'}},
+		{Type: tea.KeyRunes, Runes: []rune{'e'}},
+		{Type: tea.KeySpace, Runes: []rune{' '}},
+		{Type: tea.KeyRunes, Runes: []rune{'r'}},
+		{Type: tea.KeyRunes, Runes: []rune{'p'}},
+	} {
+		next, cmd := m.Update(msg)
+		if next.(model).status != Waiting || cmd != nil {
+			t.Fatalf("expected %q to be ignored while waiting", msg)
+		}
+		if got := planString(next.(model).items); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("%q changed the plan to %q", msg, got)
+		}
+	}
+
+	// A result arriving after the cancellation is dropped.
+	stream := m.stream
+	m.cancelQuery()
+	if !cancelled || m.status != Started {
+		t.Fatalf("expected the query to be cancelled, status %d", m.status)
+	}
+	// Back to the files as they were listed before asking.
+	expected = []string{
+		" a.jpg -> ",
+		" notes.txt -> ",
+	}
+	if got := planString(m.items); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("\nexpected: %q\ngot:      %q", expected, got)
+	}
+	next, _ := m.Update(queryResultMsg{stream: stream, plans: []llm.Plan{{}}})
+	if next.(model).status != Started {
+		t.Fatal("expected a cancelled query's result to be ignored")
+	}
+}
+
+func TestStartStreamCancelsPrevious(t *testing.T) {
+	m, _ := testModel(t, "a.jpg")
+	cancelled := false
+	m.stream = &planStream{cancel: func() { cancelled = true }}
+
+	m.startStream(nil, false, func(ctx context.Context, received chan<- llm.Received) ([]llm.Plan, error) {
+		return nil, nil
+	})
+	if !cancelled {
+		t.Fatal("expected the previous query to be cancelled")
+	}
+	m.stream.cancel()
+}
+
+func TestCancelRequeryKeepsRejections(t *testing.T) {
+	m, _ := testModel(t, "a.jpg", "notes.txt")
+	m.updateResults([]llm.Action{
+		{Type: "move", Name: "a.jpg", Result: "photos/a.jpg"},
+		{Type: "move", Name: "notes.txt", Result: "docs/notes.txt"},
+	})
+	m.status = Ready
+	for i, it := range m.items {
+		if it.name == "a.jpg" {
+			m.items[i] = m.toggleItemAction(it)
+		}
+	}
+	reviewed := planString(m.items)
+
+	m.status = Waiting
+	m.startStream(nil, false, func(ctx context.Context, received chan<- llm.Received) ([]llm.Plan, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	m.receive([]llm.Received{
+		{Candidate: 1, Action: llm.Action{Type: "move", Name: "a.jpg", Result: "pictures/a.jpg"}},
+	})
+	if got := planString(m.items); reflect.DeepEqual(got, reviewed) {
+		t.Fatal("expected the streamed plan to be shown")
+	}
+
+	m.cancelQuery()
+	if got := planString(m.items); m.status != Ready || !reflect.DeepEqual(got, reviewed) {
+		t.Fatalf("\nexpected: %q\ngot:      %q", reviewed, got)
+	}
+}
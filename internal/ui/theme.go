@@ -0,0 +1,181 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/paginator"
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// Theme holds the colors of the interface, as hex codes or ANSI color
+// numbers. An empty color leaves the terminal's own.
+type Theme struct {
+	// Accent colors titles, the selected row and new directories.
+	Accent string `json:"accent"`
+	// Muted colors borders and the start of the progress bar.
+	Muted string `json:"muted"`
+	// Rejected colors excluded items.
+	Rejected string `json:"rejected"`
+	// Warning colors warnings and resolved collisions.
+	Warning string `json:"warning"`
+	// Marked colors marked items and moved files.
+	Marked string `json:"marked"`
+	// Renamed colors renamed files.
+	Renamed string `json:"renamed"`
+	// Label colors the labels of the preview.
+	Label string `json:"label"`
+}
+
+// Themes are the built-in themes by name, DefaultTheme is the one used
+// unless another is asked for.
+var Themes = map[string]Theme{
+	"dark": {
+		Accent:   "#39FF14",
+		Muted:    "#243407",
+		Rejected: "#FF6347",
+		Warning:  "#FFD700",
+		Marked:   "#87CEFA",
+		Renamed:  "#DA70D6",
+		Label:    "#808080",
+	},
+	"light": {
+		Accent:   "#1A7F00",
+		Muted:    "#B5D99C",
+		Rejected: "#C0392B",
+		Warning:  "#9A6700",
+		Marked:   "#0B5CAD",
+		Renamed:  "#8E24AA",
+		Label:    "#5F5F5F",
+	},
+	"high-contrast": {
+		Accent:   "#00FF00",
+		Muted:    "#FFFFFF",
+		Rejected: "#FF0000",
+		Warning:  "#FFFF00",
+		Marked:   "#00FFFF",
+		Renamed:  "#FF00FF",
+		Label:    "#FFFFFF",
+	},
+}
+
+const DefaultTheme = "dark"
+
+// iconSet holds the symbols drawn in the list, the tree and the panes.
+type iconSet struct {
+	dir, file, created    string
+	expanded, collapsed   string
+	branch, lastBranch    string
+	pipe                  string
+	ellipsis              string
+	moved, chosen, times  string
+	up, down, left, right string
+}
+
+var (
+	emojiIcons = iconSet{
+		dir:        "\U0001F4C1",
+		file:       "\U0001F4C4",
+		created:    "\U00002728",
+		expanded:   "▾",
+		collapsed:  "▸",
+		branch:     "├─",
+		lastBranch: "└─",
+		pipe:       "│ ",
+		ellipsis:   "…",
+		moved:      "→",
+		chosen:     "▸",
+		times:      "×",
+		up:         "↑",
+		down:       "↓",
+		left:       "←",
+		right:      "→",
+	}
+	// asciiIcons are for terminals without emoji or box drawing glyphs.
+	asciiIcons = iconSet{
+		dir:        "[d]",
+		file:       "[f]",
+		created:    "[+]",
+		expanded:   "v",
+		collapsed:  ">",
+		branch:     "|-",
+		lastBranch: "`-",
+		pipe:       "| ",
+		ellipsis:   "...",
+		moved:      ">",
+		chosen:     ">",
+		times:      "x",
+		up:         "up",
+		down:       "down",
+		left:       "left",
+		right:      "right",
+	}
+	icons = emojiIcons
+)
+
+// color turns a theme color into a lipgloss one, no color for an empty one.
+func color(c string) lipgloss.TerminalColor {
+	if c == "" {
+		return lipgloss.NoColor{}
+	}
+	return lipgloss.Color(c)
+}
+
+// applyTheme sets the colors of all styles from t, or turns them off, and
+// picks the icons. The styles are shared by the whole package, so the last
+// model made decides.
+func applyTheme(t Theme, noColor, ascii bool) {
+	if noColor {
+		t = Theme{}
+	}
+
+	statusTitleStyle = statusTitleStyle.Foreground(color(t.Accent))
+	warningStyle = warningStyle.Foreground(color(t.Warning))
+	promptInputStyle = promptInputStyle.BorderForeground(color(t.Accent))
+
+	selectedItemStyle = selectedItemStyle.Foreground(color(t.Accent))
+	rejectedItemStyle = rejectedItemStyle.Foreground(color(t.Rejected))
+	resolvedItemStyle = resolvedItemStyle.Foreground(color(t.Warning))
+	markedItemStyle = markedItemStyle.Foreground(color(t.Marked))
+
+	paneTitleStyle = paneTitleStyle.Foreground(color(t.Accent))
+	changeStyles = map[change]lipgloss.Style{
+		created: lipgloss.NewStyle().Foreground(color(t.Accent)),
+		moved:   lipgloss.NewStyle().Foreground(color(t.Marked)),
+		renamed: lipgloss.NewStyle().Foreground(color(t.Renamed)),
+	}
+
+	previewStyle = previewStyle.BorderForeground(color(t.Muted))
+	previewTitleStyle = previewTitleStyle.Foreground(color(t.Accent))
+	previewLabelStyle = previewLabelStyle.Foreground(color(t.Label))
+
+	icons = emojiIcons
+	if ascii {
+		icons = asciiIcons
+	}
+	changeMarks[moved] = icons.moved + " "
+}
+
+// asciiList numbers the pages of the list instead of drawing dots.
+func asciiList(l *list.Model) {
+	l.Paginator.Type = paginator.Arabic
+}
+
+// newProgress makes the progress bar in the colors of t.
+func newProgress(t Theme, noColor, ascii bool) progress.Model {
+	var opts []progress.Option
+	switch {
+	case noColor || t.Accent == "":
+		opts = append(opts, progress.WithColorProfile(termenv.Ascii))
+	case strings.HasPrefix(t.Muted, "#") && strings.HasPrefix(t.Accent, "#"):
+		opts = append(opts, progress.WithScaledGradient(t.Muted, t.Accent))
+	default:
+		opts = append(opts, progress.WithSolidFill(t.Accent))
+	}
+	if ascii {
+		opts = append(opts, progress.WithFillCharacters('#', '-'))
+	}
+	return progress.New(opts...)
+}
@@ -0,0 +1,75 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/atlomak/norbot/internal/fsutils"
+	"github.com/atlomak/norbot/internal/llm"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+func TestASCIIMode(t *testing.T) {
+	t.Cleanup(func() { applyTheme(Themes[DefaultTheme], false, false) })
+
+	fsys := fsutils.NewMemFS()
+	for _, name := range []string{"IMG 1.jpg", "quarterly_financial_report_final.pdf"} {
+		if err := fsys.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := InitModel(nil, fsys, Options{NoColor: true, ASCII: true})
+	files, err := fsutils.ReadDir(fsys, ".", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.setItems(files)
+	m.updateResults([]llm.Action{
+		{Type: "move", Name: "IMG 1.jpg", Result: "photos/img_1.jpg"},
+		{Type: "move", Name: "quarterly_financial_report_final.pdf", Result: "documents/finance/quarterly_financial_report_final.pdf"},
+	})
+	m.status = Ready
+	next, _ := m.Update(tea.WindowSizeMsg{Width: 60, Height: 30})
+	m = next.(model)
+
+	for _, view := range []string{m.View(), m.diffView()} {
+		for _, r := range ansi.Strip(view) {
+			if r > unicode.MaxASCII {
+				t.Fatalf("expected only ASCII, found %q in:\n%s", r, ansi.Strip(view))
+			}
+		}
+	}
+	if view := ansi.Strip(m.View()); !strings.Contains(view, "v [d] photos") || !strings.Contains(view, "`-[f] img_1.jpg") {
+		t.Errorf("expected ASCII icons and branches in:\n%s", view)
+	}
+}
+
+func TestRowStateWithoutColor(t *testing.T) {
+	t.Cleanup(func() { applyTheme(Themes[DefaultTheme], false, false) })
+
+	m, _ := testModel(t, "a.txt", "b.txt")
+	applyTheme(Themes[DefaultTheme], true, false)
+	m.updateResults([]llm.Action{
+		{Type: "move", Name: "a.txt", Result: "notes/a.txt"},
+		{Type: "move", Name: "b.txt", Result: "notes/b.txt"},
+	})
+	m.status = Ready
+
+	// The state of a row shows as a sign, on the selected row too.
+	for m.list.Index() < len(m.list.Items())-1 {
+		m.list.CursorDown()
+	}
+	m.toggleItem()
+	view := ansi.Strip(m.View())
+	if !strings.Contains(view, ">x ") {
+		t.Errorf("expected the selected row to show it is rejected in:\n%s", view)
+	}
+	m.list.CursorDown()
+	for _, line := range strings.Split(ansi.Strip(m.View()), "\n") {
+		if strings.Contains(line, "b.txt") && !strings.HasPrefix(strings.TrimSpace(line), "x ") {
+			t.Errorf("expected the rejected row apart from the cursor, got %q", line)
+		}
+	}
+}
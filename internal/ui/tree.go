@@ -0,0 +1,159 @@
+package ui
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+)
+
+// treeNode is a file or directory in a layout of the plan, either the
+// current one or the proposed one.
+type treeNode struct {
+	name string
+	// path is slash separated, directories end with a slash.
+	path string
+	// item indexes the plan, or is -1 for a directory no item stands for.
+	item     int
+	children []*treeNode
+	// moved and kept count the files below a directory by their action.
+	moved, kept int
+}
+
+func (n *treeNode) isDir() bool {
+	return strings.HasSuffix(n.path, "/")
+}
+
+// treeRow is a visible line of a tree in the list, with a copy of the item
+// its node stands for.
+type treeRow struct {
+	node *treeNode
+	item item
+	// prefix holds the branches drawn in front of the node.
+	prefix    string
+	collapsed bool
+	marked    bool
+}
+
+func (r treeRow) FilterValue() string { return r.node.path }
+
+// currentPath places an item where it is now. Directories still to be
+// created are not there yet.
+func currentPath(it item) string {
+	return it.name
+}
+
+// proposedPath returns a function placing an item where the plan puts it.
+// Items staying in place go along with a parent directory that moves.
+func proposedPath(items []item) func(it item) string {
+	movedDirs := make(map[string]string)
+	for _, it := range items {
+		if it.action == "move" && strings.HasSuffix(it.name, "/") {
+			movedDirs[it.name] = it.result
+		}
+	}
+	return func(it item) string {
+		if it.name == "" || it.action == "move" {
+			return it.result
+		}
+		for dir := parentOf(it.name); dir != ""; dir = parentOf(dir) {
+			if result, ok := movedDirs[dir]; ok {
+				return result + strings.TrimPrefix(it.name, dir)
+			}
+		}
+		return it.name
+	}
+}
+
+// buildTree arranges items by the path placeAt puts them at, skipping the
+// ones it puts nowhere.
+func buildTree(items []item, placeAt func(it item) string) *treeNode {
+	root := &treeNode{item: -1}
+	dirs := map[string]*treeNode{"": root}
+
+	var dir func(p string) *treeNode
+	dir = func(p string) *treeNode {
+		if n, ok := dirs[p]; ok {
+			return n
+		}
+		parent := dir(parentOf(p))
+		n := &treeNode{name: path.Base(p), path: p, item: -1}
+		parent.children = append(parent.children, n)
+		dirs[p] = n
+		return n
+	}
+
+	for i, it := range items {
+		p := placeAt(it)
+		if p == "" {
+			continue
+		}
+		if strings.HasSuffix(p, "/") {
+			dir(p).item = i
+			continue
+		}
+
+		parent := dir(parentOf(p))
+		parent.children = append(parent.children, &treeNode{name: path.Base(p), path: p, item: i})
+		for n := parent; ; n = dirs[parentOf(n.path)] {
+			if it.action == "move" {
+				n.moved++
+			} else {
+				n.kept++
+			}
+			if n == root {
+				break
+			}
+		}
+	}
+
+	root.sort()
+	return root
+}
+
+// parentOf returns the directory containing p, "" for the root.
+func parentOf(p string) string {
+	parent := path.Dir(strings.TrimSuffix(p, "/")) + "/"
+	if parent == "./" {
+		return ""
+	}
+	return parent
+}
+
+func (n *treeNode) sort() {
+	sort.Slice(n.children, func(i, j int) bool {
+		return n.children[i].path < n.children[j].path
+	})
+	for _, c := range n.children {
+		c.sort()
+	}
+}
+
+// rows flattens the tree below n, leaving out what is inside collapsed
+// directories. Its children are drawn without branches.
+func (n *treeNode) rows(items []item, collapsed map[string]bool) []list.Item {
+	var rows []list.Item
+	var walk func(parent *treeNode, indent string)
+	walk = func(parent *treeNode, indent string) {
+		for i, c := range parent.children {
+			branch, next := icons.branch, icons.pipe
+			if i == len(parent.children)-1 {
+				branch, next = icons.lastBranch, "  "
+			}
+			if parent == n {
+				branch, next = "", ""
+			}
+			row := treeRow{node: c, prefix: indent + branch, collapsed: collapsed[c.path]}
+			if c.item >= 0 {
+				row.item = items[c.item]
+			}
+			rows = append(rows, row)
+			if !row.collapsed {
+				walk(c, indent+next)
+			}
+		}
+	}
+	walk(n, "")
+	return rows
+}
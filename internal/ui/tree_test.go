@@ -0,0 +1,101 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/atlomak/norbot/internal/fsutils"
+	"github.com/charmbracelet/bubbles/list"
+)
+
+func treeString(rows []list.Item) string {
+	var b strings.Builder
+	for _, r := range rows {
+		row := r.(treeRow)
+		fmt.Fprintf(&b, "%s%s", row.prefix, row.node.name)
+		if row.node.isDir() {
+			fmt.Fprintf(&b, "/ %d/%d", row.node.moved, row.node.kept)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func TestBuildTree(t *testing.T) {
+	items := []item{
+		{name: "Dir/", action: "move", result: "archive/Dir/"},
+		{name: "Dir/a.txt", action: "keep", result: "Dir/a.txt"},
+		{name: "IMG 1.jpg", action: "move", result: "photos/img_1.jpg"},
+		{name: "notes.txt", action: "keep", result: "notes.txt"},
+		{name: "report.pdf", action: "keep", result: "report.pdf", rejected: true},
+		{action: "create", result: "photos/"},
+	}
+
+	rows := buildTree(items, proposedPath(items)).rows(items, map[string]bool{})
+	expected := `archive/ 0/1
+└─Dir/ 0/1
+  └─a.txt
+notes.txt
+photos/ 1/0
+└─img_1.jpg
+report.pdf
+`
+	if got := treeString(rows); got != expected {
+		t.Fatalf("\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+	if row := rows[0].(treeRow); row.node.item != -1 {
+		t.Fatalf("expected archive/ to stand for no item, got %d", row.node.item)
+	}
+	if row := rows[1].(treeRow); row.item.name != "Dir/" {
+		t.Fatalf("expected Dir/ row to carry its item, got %v", row.item)
+	}
+
+	rows = buildTree(items, proposedPath(items)).rows(items, map[string]bool{"archive/": true})
+	expected = `archive/ 0/1
+notes.txt
+photos/ 1/0
+└─img_1.jpg
+report.pdf
+`
+	if got := treeString(rows); got != expected {
+		t.Fatalf("\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	rows = buildTree(items, currentPath).rows(items, map[string]bool{})
+	expected = `Dir/ 0/1
+└─a.txt
+IMG 1.jpg
+notes.txt
+report.pdf
+`
+	if got := treeString(rows); got != expected {
+		t.Fatalf("\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestCollapseAndExpand(t *testing.T) {
+	m, fsys := testModel(t, "docs/a.txt", "docs/b.txt", "notes.txt")
+	files, err := fsutils.ReadDir(fsys, ".", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.setItems(files)
+	if n := len(m.list.Items()); n != 4 {
+		t.Fatalf("expected 4 rows, got %d", n)
+	}
+
+	m.list.Select(1)
+	m.collapse()
+	if row := m.list.SelectedItem().(treeRow); row.node.path != "docs/" {
+		t.Fatalf("expected collapse on a file to select its directory, got %s", row.node.path)
+	}
+	m.collapse()
+	if n := len(m.list.Items()); n != 2 {
+		t.Fatalf("expected 2 rows, got %d", n)
+	}
+	m.expand()
+	if n := len(m.list.Items()); n != 4 {
+		t.Fatalf("expected 4 rows, got %d", n)
+	}
+}
@@ -0,0 +1,76 @@
+package ui
+
+import (
+	"path"
+	"strings"
+
+	"github.com/rivo/uniseg"
+)
+
+// maxExtWidth keeps long suffixes that happen to follow a dot, which are
+// unlikely to be extensions, from being kept whole.
+const maxExtWidth = 8
+
+// truncateMiddle shortens s to width terminal cells by cutting out its
+// middle, keeping the beginning, the end and the extension of a file name.
+// Wide characters count as two cells and are never split.
+func truncateMiddle(s string, width int) string {
+	if uniseg.StringWidth(s) <= width {
+		return s
+	}
+	if width <= 0 {
+		return ""
+	}
+	budget := width - uniseg.StringWidth(icons.ellipsis)
+
+	ext := path.Ext(s)
+	if strings.HasSuffix(s, "/") || strings.Contains(ext, " ") || uniseg.StringWidth(ext) > maxExtWidth {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(s, ext)
+	extWidth := uniseg.StringWidth(ext)
+	if extWidth >= budget {
+		stem, ext, extWidth = s, "", 0
+	}
+
+	rest := budget - extWidth
+	tailWidth := rest / 3
+	headWidth := rest - tailWidth
+	return head(stem, headWidth) + icons.ellipsis + tail(stem, tailWidth) + ext
+}
+
+// head returns as many whole characters from the start of s as fit width.
+func head(s string, width int) string {
+	var b strings.Builder
+	g := uniseg.NewGraphemes(s)
+	for g.Next() {
+		if width -= g.Width(); width < 0 {
+			break
+		}
+		b.WriteString(g.Str())
+	}
+	return b.String()
+}
+
+// tail returns as many whole characters from the end of s as fit width.
+func tail(s string, width int) string {
+	var clusters []string
+	var widths []int
+	g := uniseg.NewGraphemes(s)
+	for g.Next() {
+		clusters = append(clusters, g.Str())
+		widths = append(widths, g.Width())
+	}
+	start := len(clusters)
+	for start > 0 && width-widths[start-1] >= 0 {
+		width -= widths[start-1]
+		start--
+	}
+	return strings.Join(clusters[start:], "")
+}
+
+// fit truncates s to width cells and pads it with spaces to fill them.
+func fit(s string, width int) string {
+	s = truncateMiddle(s, width)
+	return s + strings.Repeat(" ", max(width-uniseg.StringWidth(s), 0))
+}
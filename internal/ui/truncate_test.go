@@ -0,0 +1,58 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/atlomak/norbot/internal/llm"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/rivo/uniseg"
+)
+
+func TestTruncateMiddle(t *testing.T) {
+	tests := []struct {
+		s        string
+		width    int
+		expected string
+	}{
+		{"notes.txt", 20, "notes.txt"},
+		{"quarterly_financial_report_final.pdf", 20, "quarterly_…final.pdf"},
+		{"photos_from_the_summer_holidays/", 16, "photos_fro…days/"},
+		{"報告書_二〇二四年_最終版.pdf", 16, "報告書_…版.pdf"},
+		{"🎉🎉🎉🎉🎉🎉🎉🎉.txt", 12, "🎉🎉…🎉.txt"},
+		{"archive.backup-2024-01-01", 12, "archive.…-01"},
+		{"a.txt", 1, "…"},
+	}
+	for _, tt := range tests {
+		got := truncateMiddle(tt.s, tt.width)
+		if got != tt.expected {
+			t.Errorf("%q in %d: expected %q, got %q", tt.s, tt.width, tt.expected, got)
+		}
+		if w := uniseg.StringWidth(got); w > tt.width {
+			t.Errorf("%q in %d: %q is %d cells wide", tt.s, tt.width, got, w)
+		}
+	}
+}
+
+func TestNarrowLayout(t *testing.T) {
+	m, _ := testModel(t, "quarterly_financial_report_final.pdf", "報告書_二〇二四年_最終版.pdf")
+	m.updateResults([]llm.Action{
+		{Type: "move", Name: "quarterly_financial_report_final.pdf", Result: "documents/finance/quarterly_financial_report_final.pdf"},
+		{Type: "move", Name: "報告書_二〇二四年_最終版.pdf", Result: "documents/報告書_二〇二四年_最終版.pdf"},
+	})
+	m.status = Ready
+
+	for _, width := range []int{40, 80, 160} {
+		next, _ := m.Update(tea.WindowSizeMsg{Width: width, Height: 20})
+		view := next.(model).View()
+		for _, line := range strings.Split(view, "\n") {
+			if w := ansi.StringWidth(line); w > width {
+				t.Fatalf("width %d: line is %d cells wide: %q", width, w, ansi.Strip(line))
+			}
+		}
+		if !strings.Contains(ansi.Strip(view), ".pdf") {
+			t.Fatalf("width %d: expected extensions to stay visible:\n%s", width, ansi.Strip(view))
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package ui
 
 import (
+	"fmt"
 	"log"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/atlomak/norbot/internal/fsutils"
@@ -12,24 +15,36 @@ import (
 func generateActionMapWithDirs(actions []llm.Action) map[string]llm.Action {
 	checkMap := make(map[string]llm.Action)
 
+	// Directories spelled in different Unicode normalization forms are the
+	// same directory, keep the first spelling the plan used.
+	dirs := make(map[string]string)
+	for _, action := range actions {
+		if strings.HasSuffix(action.Result, "/") {
+			if _, ok := dirs[fsutils.NormKey(action.Result)]; !ok {
+				dirs[fsutils.NormKey(action.Result)] = action.Result
+			}
+		}
+	}
+
 	// Prevent conflicts
 	for _, action := range actions {
+		action.Result = canonicalParents(action.Result, dirs)
 		log.Printf("add action to map: %s", action)
-		checkMap[action.Result] = action
+		checkMap[fsutils.NormKey(action.Result)] = action
 	}
 
 	// Add dirs if not exist, but prevent overrides
-	for result := range checkMap {
-		path := strings.Split(strings.TrimSuffix(result, "/"), "/")
+	for _, action := range checkMap {
+		path := strings.Split(strings.TrimSuffix(action.Result, "/"), "/")
 		if len(path) > 1 {
 			parenFolders := path[0 : len(path)-1]
 			log.Printf("parents: %v", parenFolders)
 			name := ""
 			for _, parent := range parenFolders {
 				name += parent + "/"
-				if v, ok := checkMap[name]; !ok {
+				if v, ok := checkMap[fsutils.NormKey(name)]; !ok {
 					log.Printf("create dir: %s", name)
-					checkMap[name] = llm.Action{Type: "create", Result: name}
+					checkMap[fsutils.NormKey(name)] = llm.Action{Type: "create", Result: name}
 				} else {
 					log.Printf("exists dir: %v", v)
 				}
@@ -48,6 +63,69 @@ func generateActionMapWithDirs(actions []llm.Action) map[string]llm.Action {
 	return results
 }
 
+// canonicalParents rewrites the parent directories of result to the spelling
+// registered in dirs, registering the ones seen for the first time.
+func canonicalParents(result string, dirs map[string]string) string {
+	path := strings.SplitAfter(result, "/")
+	canonical := ""
+	for i, part := range path {
+		if i == len(path)-1 || !strings.HasSuffix(part, "/") {
+			canonical += part
+			continue
+		}
+		key := fsutils.NormKey(canonical + part)
+		if spelling, ok := dirs[key]; ok {
+			canonical = spelling
+		} else {
+			canonical += part
+			dirs[key] = canonical
+		}
+	}
+	return canonical
+}
+
+// matchNames rewrites action names to the spelling found on disk when they
+// differ only in Unicode normalization, so they can be matched with files.
+func matchNames(actions []llm.Action, files fsutils.FileList) []llm.Action {
+	listed := make(map[string]string)
+	files.Walk(func(name string, _ fsutils.Node) {
+		listed[fsutils.NormKey(name)] = name
+	})
+
+	for i, action := range actions {
+		if name, ok := listed[fsutils.NormKey(action.Name)]; ok {
+			actions[i].Name = name
+		}
+	}
+	return actions
+}
+
+// caseConflicts warns about directories in the plan whose names differ only
+// by case. Case insensitive filesystems would merge them into one directory,
+// case sensitive ones keep them apart, neither is likely what was intended.
+func caseConflicts(actions map[string]llm.Action) []string {
+	spellings := make(map[string][]string)
+	for _, action := range actions {
+		if !strings.HasSuffix(action.Result, "/") {
+			continue
+		}
+		key := fsutils.FoldKey(action.Result)
+		if !slices.Contains(spellings[key], action.Result) {
+			spellings[key] = append(spellings[key], action.Result)
+		}
+	}
+
+	var warnings []string
+	for _, dirs := range spellings {
+		if len(dirs) > 1 {
+			sort.Strings(dirs)
+			warnings = append(warnings, fmt.Sprintf("directories differ only by case: %s", strings.Join(dirs, ", ")))
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
 func maxDepth(actions []llm.Action) int {
 	maxDepth := 0
 	for _, action := range actions {
@@ -60,14 +138,26 @@ func maxDepth(actions []llm.Action) int {
 	return maxDepth
 }
 
-func filesToItems(files fsutils.FileList) []list.Item {
-	items := make([]list.Item, 0, len(files))
-
-	s := strings.Split(files.String(), "\n")
-	s = s[:len(s)-1] // because of newline at the end of string
+func filesToItems(files fsutils.FileList) []item {
+	items := make([]item, 0, len(files))
+	files.Walk(func(name string, n fsutils.Node) {
+		items = append(items, item{name: name, immovable: !n.Movable()})
+	})
+	return items
+}
 
-	for _, file := range s {
-		items = append(items, item{name: file})
+func editsToItems(edits []fsutils.LinkEdit) []list.Item {
+	items := make([]list.Item, 0, len(edits))
+	for _, e := range edits {
+		items = append(items, linkItem{edit: e})
 	}
 	return items
 }
+
+func scanWarnings(files fsutils.FileList) []string {
+	var warnings []string
+	for _, err := range files.Errors() {
+		warnings = append(warnings, fmt.Sprintf("could not read %s", err))
+	}
+	return warnings
+}
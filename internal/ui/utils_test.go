@@ -57,6 +57,18 @@ func TestActionsToMap(t *testing.T) {
 				"file2.txt":  {Type: "move", Result: "root/dir2/file2.txt", Name: "file2.txt"},
 			},
 		},
+		{
+			name: "Directories differing only in normalization",
+			actions: []llm.Action{
+				{Type: "move", Result: "Caf\u00e9/a.txt", Name: "a.txt"},
+				{Type: "move", Result: "Cafe\u0301/b.txt", Name: "b.txt"},
+			},
+			expected: map[string]llm.Action{
+				"Caf\u00e9/": {Type: "create", Result: "Caf\u00e9/"},
+				"a.txt":      {Type: "move", Result: "Caf\u00e9/a.txt", Name: "a.txt"},
+				"b.txt":      {Type: "move", Result: "Caf\u00e9/b.txt", Name: "b.txt"},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -68,3 +80,17 @@ func TestActionsToMap(t *testing.T) {
 		})
 	}
 }
+
+func TestCaseConflicts(t *testing.T) {
+	actions := generateActionMapWithDirs([]llm.Action{
+		{Type: "keep", Result: "Photos/", Name: "Photos/"},
+		{Type: "move", Result: "photos/a.jpg", Name: "a.jpg"},
+		{Type: "move", Result: "docs/a.txt", Name: "a.txt"},
+	})
+
+	expected := []string{"directories differ only by case: Photos/, photos/"}
+	got := caseConflicts(actions)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("caseConflicts() = %v, want %v", got, expected)
+	}
+}